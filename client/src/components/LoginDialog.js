@@ -100,6 +100,9 @@ export default function FormDialog(props) {
                 <Button onClick={handleClose} color="secondary">
                     Cancel
                 </Button>
+                <Button href={API.OAuthAuthorizeUrl} color="primary">
+                    Hosted UI
+                </Button>
                 <Button onClick={handleGetToken} color="primary">
                     Get Token
                 </Button>
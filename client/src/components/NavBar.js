@@ -7,6 +7,7 @@ import Button from '@material-ui/core/Button';
 import LoginDialog from './LoginDialog'
 import SecurityRoundedIcon from '@material-ui/icons/SecurityRounded';
 import { LoginManager } from '../utils/LoginManager'
+import { API } from '../utils/Api'
 import Container from '@material-ui/core/Container';
 import FetchUserTable from './FetchUserTable'
 
@@ -25,6 +26,8 @@ const useStyles = makeStyles(theme => ({
   },
 }));
 
+LoginManager.TakeTokenFromUrl()
+
 export default function NavBar() {
 
   const [isLoggedIn, setIsLoggedIn] = React.useState(LoginManager.IsLoggedIn());
@@ -42,8 +45,12 @@ export default function NavBar() {
 
   const handleLogin = () => {
     if (LoginManager.IsLoggedIn()) {
-      LoginManager.LogOut()
-      setIsLoggedIn(false)
+      const logOut = () => {
+        LoginManager.LogOut()
+        setIsLoggedIn(false)
+      }
+      // The cookie is dropped even when the server cannot be reached
+      API.FetchLogout().then(logOut, logOut)
     }
     else {
       setOpen(true)
@@ -7,6 +7,8 @@ let backendPort = process.env.APP_BACKEND_PORT || '5000';
 const API_ROOT = `${backendHost}:${backendPort}/api/`
 const API_LIST_USERS = API_ROOT + "user/list"
 const API_GET_TOKEN = API_ROOT + "token"
+const API_OAUTH_AUTHORIZE = API_ROOT + "oauth/authorize"
+const API_LOGOUT = API_ROOT + "logout"
 
 const FetchListUsers = () => {
   let access_token = LoginManager.GetToken()
@@ -21,6 +23,7 @@ const FetchListUsers = () => {
 
 const FetchGetToken = (username, password) => {
   let formData = new URLSearchParams();
+  formData.append("grant_type", "password")
   formData.append("username", username)
   formData.append("password", password)
   return fetch(API_GET_TOKEN, {
@@ -32,11 +35,27 @@ const FetchGetToken = (username, password) => {
   })
 }
 
+// FetchLogout signs the user out of every device, the tokens stop working
+const FetchLogout = () => {
+  let access_token = LoginManager.GetToken()
+  return fetch(API_LOGOUT, {
+    method: "POST",
+    headers: {
+      "Authorization": "Bearer " + access_token,
+      "Content-Type": "application/json",
+    },
+    body: "{}",
+  })
+}
+
 export const API = {
   Url: API_ROOT,
   ListUsersUrl: API_LIST_USERS,
   FetchListUsers,
   GetTokenUrl: API_GET_TOKEN,
   FetchGetToken,
+  OAuthAuthorizeUrl: API_OAUTH_AUTHORIZE,
+  LogoutUrl: API_LOGOUT,
+  FetchLogout,
 }
 
@@ -23,9 +23,24 @@ const GetToken = () => {
     return access_token
 }
 
+// The hosted UI login hands the tokens back in the URL fragment
+const TakeTokenFromUrl = () => {
+    const params = new URLSearchParams(window.location.hash.substring(1))
+    if (params.has("access_token")) {
+        SetToken(params.get("access_token"))
+    }
+    if (params.has("error")) {
+        console.log(params.get("error"), params.get("error_description"))
+    }
+    if (params.has("access_token") || params.has("error")) {
+        window.history.replaceState(null, "", window.location.pathname + window.location.search)
+    }
+}
+
 export const LoginManager = {
     IsLoggedIn,
     LogOut,
     SetToken,
     GetToken,
+    TakeTokenFromUrl,
 }
\ No newline at end of file
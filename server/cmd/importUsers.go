@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	"github.com/paujim/cognitoserver/server/pkg/services"
+)
+
+// importUsers runs the import-users subcommand against the configured user pool and prints the report,
+// it exits with 1 when a user failed
+func importUsers(args []string) int {
+	flags := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: import-users [flags] FILE (.csv or .jsonl)")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "", "csv or jsonl, defaults to the file extension")
+	dryRun := flags.Bool("dry-run", false, "validate the users without creating them")
+	concurrency := flags.Int("concurrency", importConcurrency, "users created at a time")
+	messageAction := flags.String("message-action", "", "SUPPRESS to send no invitation, or RESEND")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	importer := services.NewUserImporter(cognito, *concurrency)
+	rows, err := importer.ReadUsers(file, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	options := entities.ImportOptions{DryRun: *dryRun}
+	if *messageAction != "" {
+		options.MessageAction = messageAction
+	}
+	report := importer.ImportUsers(rows, options)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"math/rand"
+	"os"
+	"os/signal"
 	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -18,13 +25,48 @@ import (
 
 const (
 	region = "us-west-2"
+
+	jwksRefreshInterval    = time.Hour
+	jwksMinRefreshInterval = time.Minute
+
+	policyReloadInterval = 30 * time.Second
+
+	// Attempts allowed per username and per client IP on the public account recovery endpoints
+	throttleLimit  = 10
+	throttleWindow = 15 * time.Minute
+
+	// Users created at a time by the bulk imports
+	importConcurrency = 4
+
+	offlineUserPoolID  = region + "_offline"
+	offlineAppClientID = "offline"
 )
 
 var (
-	cognito    entities.UserTokenHandler
-	userPoolID string
+	cognito     entities.UserTokenHandler
+	userPoolID  string
+	appClientID string
+	keySource   entities.KeySource
 )
 
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// splitList parses a comma separated list
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func randomString(length int) string {
 	charset := "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, length)
@@ -34,23 +76,121 @@ func randomString(length int) string {
 	return string(b)
 }
 
+// parseFakeUsers reads users as "username:password[:group1|group2]" separated by commas
+func parseFakeUsers(value string) []services.FakeUser {
+	users := []services.FakeUser{}
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(fields) < 2 {
+			log.Warnf("Ignoring fake user [%v]\n", entry)
+			continue
+		}
+		user := services.FakeUser{Username: fields[0], Password: fields[1]}
+		if len(fields) == 3 && fields[2] != "" {
+			user.Groups = strings.Split(fields[2], "|")
+		}
+		users = append(users, user)
+	}
+	return users
+}
+
+// parseFakeClients reads app clients as "clientID:secret[:scope1|scope2]" separated by commas
+func parseFakeClients(value string) []services.FakeClient {
+	clients := []services.FakeClient{}
+	if value == "" {
+		return clients
+	}
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(fields) < 2 {
+			log.Warnf("Ignoring fake client [%v]\n", entry)
+			continue
+		}
+		client := services.FakeClient{ClientID: fields[0], ClientSecret: fields[1]}
+		if len(fields) == 3 && fields[2] != "" {
+			client.Scopes = strings.Split(fields[2], "|")
+		}
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// reloadPolicyOnHangup reloads the policy file on SIGHUP
+func reloadPolicyOnHangup(policy entities.PolicyEvaluator) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := policy.Reload(); err != nil {
+				log.Errorf("Fail to reload policy, keeping the previous one: %v\n", err.Error())
+			}
+		}
+	}()
+}
+
 func init() {
 	log.SetFormatter(&log.JSONFormatter{})
 
+	// COGNITO_OFFLINE boots against an in-memory user pool, no AWS access needed
+	if offline, _ := strconv.ParseBool(os.Getenv("COGNITO_OFFLINE")); offline {
+		fakeUsers := os.Getenv("COGNITO_FAKE_USERS")
+		if fakeUsers == "" {
+			fakeUsers = "admin:" + randomString(12) + ":admin"
+			log.Warnf("COGNITO_FAKE_USERS not set, created user [%v]\n", fakeUsers)
+		}
+		var err error
+		userPoolID = offlineUserPoolID
+		cognito, keySource, err = services.NewFakeCognitoHandler(region, userPoolID, offlineAppClientID,
+			parseFakeUsers(fakeUsers), parseFakeClients(os.Getenv("COGNITO_FAKE_CLIENTS")))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	sess, _ := session.NewSession(&aws.Config{
 		Region: aws.String(region),
 	})
 	paramStore := services.NewParameterStore(ssm.New(sess))
-	userPoolID, _ := paramStore.Get("/pj/userpool/id")
-	appClientID, _ := paramStore.Get("/pj/userpool/appclient/id")
-	cognito = services.NewCognitoHandler(appClientID, userPoolID, cognitoidentityprovider.New(sess))
+	userPoolID, _ = paramStore.Get("/pj/userpool/id")
+	appClientID, _ = paramStore.Get("/pj/userpool/appclient/id")
+
+	// The OAuth 2.0 endpoints live on the user pool domain, OAUTH2_TOKEN_URL overrides the token endpoint
+	options := []services.CognitoOption{}
+	tokenURL := os.Getenv("OAUTH2_TOKEN_URL")
+	if domain, err := paramStore.Get("/pj/userpool/domain"); err == nil {
+		domainURL := fmt.Sprintf("https://%v.auth.%v.amazoncognito.com", domain, region)
+		options = append(options, services.WithAuthorizeURL(domainURL+"/oauth2/authorize"))
+		if tokenURL == "" {
+			tokenURL = domainURL + "/oauth2/token"
+		}
+	}
+	if tokenURL != "" {
+		options = append(options, services.WithTokenURL(tokenURL))
+	}
+	// COGNITO_AUTH_FLOW selects how users prove their password to Cognito
+	switch authFlow := getenv("COGNITO_AUTH_FLOW", "USER_PASSWORD_AUTH"); authFlow {
+	case "USER_SRP_AUTH":
+		options = append(options, services.WithSRPAuth())
+	case "USER_PASSWORD_AUTH":
+	default:
+		log.Fatalf("Unsupported COGNITO_AUTH_FLOW [%v]\n", authFlow)
+	}
+	cognito = services.NewCognitoHandler(appClientID, userPoolID, cognitoidentityprovider.New(sess), options...)
 
 }
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "import-users" {
+		os.Exit(importUsers(os.Args[2:]))
+	}
+
 	// Set the router as the default one shipped with Gin
 	router := gin.Default()
+	// TRUST_PROXY_HEADERS takes the client IP from X-Forwarded-For or X-Real-Ip, any client can set them
+	// so it is only safe behind a proxy that overwrites them. The throttling is per IP.
+	router.ForwardedByClientIP, _ = strconv.ParseBool(os.Getenv("TRUST_PROXY_HEADERS"))
 
 	// Serve frontend static files
 	router.Use(static.Serve("/", static.LocalFile(path.Join("..", "client", "build"), true)))
@@ -61,10 +201,71 @@ func main() {
 	// No auth
 	controllers.RegisterPing(api)
 
-	a := controllers.NewAuth(region, userPoolID, cognito)
+	if keySource == nil {
+		// JWKS_LOCATION overrides where the user pool keys are loaded from (URL or local file)
+		jwksLocation := os.Getenv("JWKS_LOCATION")
+		if jwksLocation == "" {
+			jwksLocation = fmt.Sprintf("https://cognito-idp.%v.amazonaws.com/%v/.well-known/jwks.json", region, userPoolID)
+		}
+		var err error
+		keySource, err = services.NewKeySource(jwksLocation)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		// Publish the keys of the offline user pool
+		controllers.RegisterJWKS(api, keySource)
+	}
+	jwks := services.NewJWKSCache(keySource, jwksRefreshInterval, jwksMinRefreshInterval)
+	defer jwks.Close()
+
+	// The denylist is in memory, the tokens revoked on an instance are only refused by it
+	denylist := services.NewTokenDenylist()
+	a := controllers.NewAuth(region, userPoolID, cognito, jwks, denylist)
 	a.RegisterAuthRoutes(api)
+	// INTROSPECTION_API_KEY lets the callers without client credentials introspect the tokens
+	a.RegisterIntrospectionRoutes(api, os.Getenv("INTROSPECTION_API_KEY"))
+	passwords := controllers.NewPassword(cognito, services.NewRateLimiter(throttleLimit, throttleWindow))
+	passwords.RegisterPasswordRoutes(api.Group("/password"))
+	// SIGNUP_ENABLED=false leaves user creation to administrators
+	signUpEnabled, err := strconv.ParseBool(getenv("SIGNUP_ENABLED", "true"))
+	if err != nil {
+		log.Fatalf("Invalid SIGNUP_ENABLED: %v\n", err.Error())
+	}
+	controllers.NewSignUp(cognito, services.NewRateLimiter(throttleLimit, throttleWindow), signUpEnabled).RegisterSignUpRoutes(api.Group("/signup"))
+	// OAUTH2_CALLBACK_URL enables the hosted UI login, it must be registered on the app client
+	if callbackURL := os.Getenv("OAUTH2_CALLBACK_URL"); callbackURL != "" {
+		a.RegisterOAuthRoutes(api, controllers.OAuthConfig{
+			ClientID:    appClientID,
+			CallbackURL: callbackURL,
+			ClientURL:   getenv("OAUTH2_CLIENT_URL", "/"),
+			Scope:       getenv("OAUTH2_SCOPE", "openid email profile"),
+		})
+	}
 	api.Use(a.AuthMiddleware())
-	controllers.NewUser(cognito).RegisterUserRoutes(api.Group("/user"))
+
+	// POLICY_FILE describes who may call which route, POLICY_DRY_RUN only logs the denials
+	policy, err := services.NewPolicyEvaluator(getenv("POLICY_FILE", "policy.yaml"), policyReloadInterval)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer policy.Close()
+	reloadPolicyOnHangup(policy)
+	dryRun, _ := strconv.ParseBool(os.Getenv("POLICY_DRY_RUN"))
+	api.Use(controllers.PolicyMiddleware(policy, dryRun))
+
+	// USER_ATTRIBUTES is the allowlist of the user attributes the API exposes
+	userAttributes := splitList(getenv("USER_ATTRIBUTES", "sub,email,email_verified,phone_number,name"))
+	controllers.NewUser(cognito, userAttributes).RegisterUserRoutes(api.Group("/user"))
+	a.RegisterLogoutRoutes(api)
+	admin := api.Group("/admin")
+	controllers.NewAdmin(cognito, userAttributes, denylist).RegisterAdminRoutes(admin)
+	controllers.NewGroups(cognito, cognito, userAttributes, denylist).RegisterGroupRoutes(admin)
+	controllers.NewUserExport(cognito, userAttributes).RegisterUserExportRoutes(admin)
+	controllers.NewUserImport(services.NewUserImporter(cognito, importConcurrency)).RegisterUserImportRoutes(admin)
+	// MFA_ISSUER names the account in the authenticator apps
+	passwords.RegisterChangePasswordRoutes(api.Group("/user/me"))
+	controllers.NewMFA(cognito, getenv("MFA_ISSUER", "cognitoserver")).RegisterMFARoutes(api.Group("/user/me/mfa"))
 
 	// Start and run the server
 	router.Run(":5000")
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+type admin struct {
+	service    entities.UserAdmin
+	attributes []string
+	denylist   entities.TokenDenylist
+}
+
+// NewAdmin manages the users of the pool, its routes must be restricted to administrators by the policy.
+// Only the user attributes in the allowlist are exposed. The tokens of the users signed out, disabled or
+// deleted are added to the denylist.
+func NewAdmin(service entities.UserAdmin, attributes []string, denylist entities.TokenDenylist) *admin {
+	return &admin{
+		service:    service,
+		attributes: attributes,
+		denylist:   denylist,
+	}
+}
+
+func (a *admin) RegisterAdminRoutes(router *gin.RouterGroup) {
+	router.POST("/users", a.createUser)
+	router.GET("/users/:username", a.getUser)
+	router.PATCH("/users/:username", a.updateUser)
+	router.DELETE("/users/:username", a.deleteUser)
+	router.POST("/users/:username/enable", a.enableUser)
+	router.POST("/users/:username/disable", a.disableUser)
+	router.POST("/users/:username/signout", a.signOutUser)
+}
+
+func (a *admin) createUser(c *gin.Context) {
+	var request entities.CreateUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Username == nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "username is required"))
+		return
+	}
+	user, err := a.service.CreateUser(&request)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	user.RestrictAttributes(a.attributes)
+	c.JSON(http.StatusCreated, user)
+}
+
+func (a *admin) getUser(c *gin.Context) {
+	username := usernameParam(c)
+	user, err := a.service.GetUser(username)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	if includeGroups, _ := strconv.ParseBool(c.Query("include_groups")); includeGroups {
+		groups, ok := a.service.(entities.GroupAdmin)
+		if !ok {
+			abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "groups are not supported"))
+			return
+		}
+		if user.Groups, err = groups.UserGroups(username); err != nil {
+			abortWithOAuthError(c, apiError(err))
+			return
+		}
+	}
+	user.RestrictAttributes(a.attributes)
+	c.JSON(http.StatusOK, user)
+}
+
+// updateUser sets the attributes of the request and deletes the null ones, all of them must be in the allowlist
+func (a *admin) updateUser(c *gin.Context) {
+	var request entities.UpdateUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Attributes) == 0 {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "attributes are required"))
+		return
+	}
+	username := usernameParam(c)
+	updated := map[string]string{}
+	deleted := []string{}
+	for name, value := range request.Attributes {
+		if !entities.AttributeAllowed(a.attributes, name) {
+			abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "attribute "+name+" cannot be changed"))
+			return
+		}
+		if value == nil {
+			deleted = append(deleted, name)
+		} else {
+			updated[name] = *value
+		}
+	}
+	if len(updated) > 0 {
+		if err := a.service.UpdateUserAttributes(username, updated); err != nil {
+			abortWithOAuthError(c, apiError(err))
+			return
+		}
+	}
+	if len(deleted) > 0 {
+		if err := a.service.DeleteUserAttributes(username, deleted); err != nil {
+			abortWithOAuthError(c, apiError(err))
+			return
+		}
+	}
+	a.userResponse(c, username)
+}
+
+func (a *admin) deleteUser(c *gin.Context) {
+	revokeTokens(c, a.service, a.denylist, a.service.DeleteUser)
+}
+
+func (a *admin) enableUser(c *gin.Context) {
+	if err := a.service.EnableUser(usernameParam(c)); err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (a *admin) disableUser(c *gin.Context) {
+	revokeTokens(c, a.service, a.denylist, a.service.DisableUser)
+}
+
+// signOutUser revokes every token of the user
+func (a *admin) signOutUser(c *gin.Context) {
+	handler, ok := a.service.(entities.SignOutHandler)
+	if !ok {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "sign out is not supported"))
+		return
+	}
+	revokeTokens(c, a.service, a.denylist, handler.AdminGlobalSignOut)
+}
+
+// revokeTokens applies the action to the user of the route, then denies the access tokens already issued to them.
+// The route may name the user by an alias such as the email, the tokens carry the canonical username.
+func revokeTokens(c *gin.Context, users entities.UserAdmin, denylist entities.TokenDenylist, action func(username *string) error) {
+	user, err := users.GetUser(usernameParam(c))
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	if err := action(user.Username); err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	if err := denyUser(denylist, *user.Username); err != nil {
+		log.Errorf("Unable to deny the tokens of %v: %v\n", *user.Username, err)
+		abortWithOAuthError(c, newOAuthError(http.StatusServiceUnavailable, "temporarily_unavailable", "the tokens could not be revoked"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (a *admin) userResponse(c *gin.Context, username *string) {
+	user, err := a.service.GetUser(username)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	user.RestrictAttributes(a.attributes)
+	c.JSON(http.StatusOK, user)
+}
+
+func usernameParam(c *gin.Context) *string {
+	username := c.Param("username")
+	return &username
+}
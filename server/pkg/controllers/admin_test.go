@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	"github.com/paujim/cognitoserver/server/pkg/services"
+)
+
+// aliasedUsers knows bob, also by the email alias, and records the usernames it is called with
+type aliasedUsers struct {
+	entities.UserAdmin
+	called []string
+}
+
+func (a *aliasedUsers) GetUser(username *string) (*entities.UserModel, error) {
+	if *username != "bob" && *username != "bob@example.com" {
+		return nil, awserr.New("UserNotFoundException", "User does not exist.", nil)
+	}
+	return &entities.UserModel{Username: aws.String("bob"), Email: aws.String("bob@example.com")}, nil
+}
+
+func (a *aliasedUsers) DisableUser(username *string) error {
+	a.called = append(a.called, *username)
+	return nil
+}
+
+func (a *aliasedUsers) DeleteUser(username *string) error {
+	a.called = append(a.called, *username)
+	return nil
+}
+
+func (a *aliasedUsers) RevokeToken(*string) error {
+	return nil
+}
+
+func (a *aliasedUsers) GlobalSignOut(*string) error {
+	return nil
+}
+
+func (a *aliasedUsers) AdminGlobalSignOut(username *string) error {
+	a.called = append(a.called, *username)
+	return nil
+}
+
+func TestAdminRevokeTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	requests := []struct{ method, path string }{
+		{http.MethodPost, "/api/admin/users/bob@example.com/signout"},
+		{http.MethodPost, "/api/admin/users/bob@example.com/disable"},
+		{http.MethodDelete, "/api/admin/users/bob@example.com"},
+	}
+	for _, request := range requests {
+		t.Run("Successfull "+request.method+" "+request.path+" by alias", func(t *testing.T) {
+			service := &aliasedUsers{}
+			denylist := services.NewTokenDenylist()
+			router := gin.New()
+			NewAdmin(service, []string{"email"}, denylist).RegisterAdminRoutes(router.Group("/api/admin"))
+
+			issued := time.Now().Add(-time.Minute)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(request.method, request.path, nil))
+			if recorder.Code != http.StatusNoContent {
+				t.Fatalf("204 expected, got %v: %v", recorder.Code, recorder.Body.String())
+			}
+			if len(service.called) != 1 || service.called[0] != "bob" {
+				t.Errorf("Canonical username expected: %v", service.called)
+			}
+			if denied, _ := denylist.Denied(entities.DeniedUserKey("bob"), issued); !denied {
+				t.Errorf("Tokens of the canonical username expected to be denied")
+			}
+		})
+	}
+	t.Run("Fail revoking the tokens of an unknown user", func(t *testing.T) {
+		service := &aliasedUsers{}
+		router := gin.New()
+		NewAdmin(service, []string{"email"}, services.NewTokenDenylist()).RegisterAdminRoutes(router.Group("/api/admin"))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/admin/users/carol/disable", nil))
+		if recorder.Code != http.StatusNotFound || len(service.called) != 0 {
+			t.Errorf("404 expected, got %v", recorder.Code)
+		}
+	})
+}
+
+func TestRevoked(t *testing.T) {
+	denylist := services.NewTokenDenylist()
+	a := &auth{denylist: denylist}
+	now := time.Now()
+	principal := &entities.Principal{Username: "bob", TokenID: "jti", OriginTokenID: "origin", IssuedAt: now.Truncate(time.Second)}
+
+	t.Run("Allow a token issued in the second of a global sign out, before or after it", func(t *testing.T) {
+		if err := denylist.Deny(entities.DeniedUserKey("bob"), now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := a.revoked(principal); err != nil || revoked {
+			t.Errorf("Token issued in the second of the sign out expected to be active")
+		}
+	})
+	t.Run("Deny a logged out token issued in the same second", func(t *testing.T) {
+		if err := denylist.Deny("origin", now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := a.revoked(principal); err != nil || !revoked {
+			t.Errorf("Token of the logged out login expected to be revoked")
+		}
+	})
+}
@@ -1,14 +1,9 @@
 package controllers
 
 import (
-	"crypto/rsa"
-	"encoding/base64"
-	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"math/big"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -16,32 +11,48 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	principalKey = "principal"
+	// maxAccessTokenLifetime is the longest validity of a Cognito access token, the denylist keeps the revoked ones as long
+	maxAccessTokenLifetime = 24 * time.Hour
 )
 
 type auth struct {
 	userPoolRegion string
 	userPoolID     string
 	service        entities.TokenHandler
+	keys           entities.KeyProvider
+	denylist       entities.TokenDenylist
+	oauth          OAuthConfig
+	// introspectionKey authenticates the introspection callers besides the app clients, unset disables it
+	introspectionKey string
 }
 
-func NewAuth(region, userPoolID string, service entities.TokenHandler) *auth {
+// NewAuth validates the access tokens, refusing the ones revoked on logout through the denylist
+func NewAuth(region, userPoolID string, service entities.TokenHandler, keys entities.KeyProvider, denylist entities.TokenDenylist) *auth {
 	return &auth{
 		userPoolRegion: region,
 		userPoolID:     userPoolID,
 		service:        service,
+		keys:           keys,
+		denylist:       denylist,
 	}
 }
 
 func (a *auth) RegisterAuthRoutes(router *gin.RouterGroup) {
 	router.POST("/token", a.getAccessToken)
+	router.POST("/token/challenge", a.respondToChallenge)
 }
 
-func (a *auth) AuthMiddleware() gin.HandlerFunc {
-	//Download and store the JSON Web Key (JWK) for your user pool.
-	jwkURL := fmt.Sprintf("https://cognito-idp.%v.amazonaws.com/%v/.well-known/jwks.json", a.userPoolRegion, a.userPoolID)
-	log.Println(jwkURL)
-	jwk := a.getJWK(jwkURL)
+// RegisterLogoutRoutes must be registered behind the AuthMiddleware
+func (a *auth) RegisterLogoutRoutes(router *gin.RouterGroup) {
+	router.POST("/logout", requireUser, a.logout)
+}
 
+func (a *auth) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString, ok := a.getBearer(c.Request.Header["Authorization"])
 		if !ok {
@@ -50,50 +61,97 @@ func (a *auth) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		token, err := a.validateToken(tokenString, jwk)
+		token, err := a.validateToken(tokenString)
 		if err != nil || !token.Valid {
 			c.AbortWithStatusJSON(401, gin.H{"error": "invalid_token"})
 		} else {
+			principal := a.principalFromClaims(token.Claims.(jwt.MapClaims))
+			revoked, err := a.revoked(principal)
+			if err != nil {
+				log.Errorf("Unable to check the token denylist: %v\n", err)
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "temporarily_unavailable"})
+				return
+			}
+			if revoked {
+				c.AbortWithStatusJSON(401, gin.H{"error": "invalid_token", "error_description": "token has been revoked"})
+				return
+			}
 			// All Good :)
+			principal.AccessToken = tokenString
 			c.Set("token", token)
+			c.Set(principalKey, principal)
+			c.Request = c.Request.WithContext(entities.NewContextWithPrincipal(c.Request.Context(), principal))
 			c.Next()
 		}
 	}
 }
 
-type jwkKey struct {
-	Alg string
-	E   string
-	Kid string
-	Kty string
-	N   string
-	Use string
+// GetPrincipal returns the caller authenticated by AuthMiddleware
+func GetPrincipal(c *gin.Context) (*entities.Principal, bool) {
+	if value, ok := c.Get(principalKey); ok {
+		principal, ok := value.(*entities.Principal)
+		return principal, ok
+	}
+	return nil, false
 }
 
-func (a *auth) getJWK(jwkURL string) map[string]jwkKey {
-	type JWK struct {
-		Keys []jwkKey
+func (a *auth) principalFromClaims(claims jwt.MapClaims) *entities.Principal {
+	principal := &entities.Principal{
+		Subject:  claimString(claims, "sub"),
+		Username: claimString(claims, "username"),
+		ClientID: claimString(claims, "client_id"),
+		Groups:   []string{},
+		Scopes:   strings.Fields(claimString(claims, "scope")),
 	}
-	getJSON := func(url string, target interface{}) error {
-		var myClient = &http.Client{Timeout: 10 * time.Second}
-		r, err := myClient.Get(url)
-		if err != nil {
-			return err
+	if groups, ok := claims["cognito:groups"].([]interface{}); ok {
+		for _, group := range groups {
+			if groupStr, ok := group.(string); ok {
+				principal.Groups = append(principal.Groups, groupStr)
+			}
 		}
-		defer r.Body.Close()
-
-		return json.NewDecoder(r.Body).Decode(target)
 	}
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		principal.AuthTime = time.Unix(int64(authTime), 0)
+	}
+	if iat, ok := claims["iat"].(float64); ok {
+		principal.IssuedAt = time.Unix(int64(iat), 0)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		principal.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	principal.TokenID = claimString(claims, "jti")
+	principal.OriginTokenID = claimString(claims, "origin_jti")
+	return principal
+}
 
-	jwk := &JWK{}
+// revoked checks the denylist for the token, its login and its user.
+// The token ids only name revoked tokens, so they are checked whatever their issue time.
+func (a *auth) revoked(principal *entities.Principal) (bool, error) {
+	keys := map[string]time.Time{principal.TokenID: {}, principal.OriginTokenID: {}}
+	if !principal.IsClient() {
+		keys[entities.DeniedUserKey(principal.Username)] = principal.IssuedAt
+	}
+	for key, issuedAt := range keys {
+		if key == "" {
+			continue
+		}
+		if denied, err := a.denylist.Denied(key, issuedAt); err != nil || denied {
+			return denied, err
+		}
+	}
+	return false, nil
+}
 
-	getJSON(jwkURL, jwk)
+// denyUser revokes the access tokens already issued to the user, Cognito only stops their refresh
+func denyUser(denylist entities.TokenDenylist, username string) error {
+	return denylist.Deny(entities.DeniedUserKey(username), time.Now().Add(maxAccessTokenLifetime))
+}
 
-	jwkMap := make(map[string]jwkKey)
-	for _, jwk := range jwk.Keys {
-		jwkMap[jwk.Kid] = jwk
+func claimString(claims jwt.MapClaims, key string) string {
+	if val, ok := claims[key].(string); ok {
+		return val
 	}
-	return jwkMap
+	return ""
 }
 
 func (a *auth) getBearer(auth []string) (jwt string, ok bool) {
@@ -106,7 +164,12 @@ func (a *auth) getBearer(auth []string) (jwt string, ok bool) {
 	return "", false
 }
 
-func (a *auth) validateToken(tokenStr string, jwk map[string]jwkKey) (*jwt.Token, error) {
+func (a *auth) validateToken(tokenStr string) (*jwt.Token, error) {
+	return a.parseToken(tokenStr, "access")
+}
+
+// parseToken verifies the signature and standard claims of a user pool token of the given token_use (access or id)
+func (a *auth) parseToken(tokenStr, tokenUse string) (*jwt.Token, error) {
 
 	//Decode the token string into JWT format.
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
@@ -119,15 +182,12 @@ func (a *auth) validateToken(tokenStr string, jwk map[string]jwkKey) (*jwt.Token
 		// Get the kid from the JWT token header and retrieve the corresponding JSON Web Key that was stored
 		if kid, ok := token.Header["kid"]; ok {
 			if kidStr, ok := kid.(string); ok {
-				key := jwk[kidStr]
 				// Verify the signature of the decoded JWT token.
-				rsaPublicKey := publicKey(key.E, key.N)
-				return rsaPublicKey, nil
+				return a.keys.GetKey(kidStr)
 			}
 		}
 
-		// rsa public key
-		return "", nil
+		return nil, errors.New("token does not contain kid")
 	})
 
 	if err != nil {
@@ -149,7 +209,7 @@ func (a *auth) validateToken(tokenStr string, jwk map[string]jwkKey) (*jwt.Token
 	}
 
 	// Check the token_use claim.
-	err = a.validateTokenUse(claims)
+	err = a.validateTokenUse(claims, tokenUse)
 	if err != nil {
 		return nil, err
 	}
@@ -163,37 +223,15 @@ func (a *auth) validateToken(tokenStr string, jwk map[string]jwkKey) (*jwt.Token
 	return token, nil
 }
 
-func publicKey(rawE, rawN string) *rsa.PublicKey {
-	decodedE, err := base64.RawURLEncoding.DecodeString(rawE)
-	if err != nil {
-		panic(err)
-	}
-	if len(decodedE) < 4 {
-		ndata := make([]byte, 4)
-		copy(ndata[4-len(decodedE):], decodedE)
-		decodedE = ndata
-	}
-	pubKey := &rsa.PublicKey{
-		N: &big.Int{},
-		E: int(binary.BigEndian.Uint32(decodedE[:])),
-	}
-	decodedN, err := base64.RawURLEncoding.DecodeString(rawN)
-	if err != nil {
-		panic(err)
-	}
-	pubKey.N.SetBytes(decodedN)
-	return pubKey
-}
-
-func (a *auth) validateTokenUse(claims jwt.MapClaims) error {
+func (a *auth) validateTokenUse(claims jwt.MapClaims, tokenUseShouldBe string) error {
 	if tokenUse, ok := claims["token_use"]; ok {
 		if tokenUseStr, ok := tokenUse.(string); ok {
-			if tokenUseStr == "access" {
+			if tokenUseStr == tokenUseShouldBe {
 				return nil
 			}
 		}
 	}
-	return errors.New("token_use should be access")
+	return fmt.Errorf("token_use should be %v", tokenUseShouldBe)
 }
 
 func (a *auth) validateClaimItem(key string, keyShouldBe []string, claims jwt.MapClaims) error {
@@ -222,30 +260,170 @@ func (a *auth) validateExpired(claims jwt.MapClaims) error {
 	return errors.New("token is expired")
 }
 
+type grantHandler func(c *gin.Context, request *entities.TokenRequest) (*entities.Tokens, *entities.Challenge, error)
+
 func (a *auth) getAccessToken(c *gin.Context) {
+	// Responses carry credentials and must not be cached
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
 	var request entities.TokenRequest
-	c.ShouldBind(&request)
+	if err := c.ShouldBind(&request); err != nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+	if request.GrantType == nil || *request.GrantType == "" {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "grant_type is required"))
+		return
+	}
 
-	var accessToken, refreshToken *string
-	var err error
+	grants := map[string]grantHandler{
+		"password":           a.passwordGrant,
+		"refresh_token":      a.refreshTokenGrant,
+		"client_credentials": a.clientCredentialsGrant,
+		"authorization_code": a.authorizationCodeGrant,
+	}
+	grant, ok := grants[*request.GrantType]
+	if !ok {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "grant_type "+*request.GrantType+" is not supported"))
+		return
+	}
 
-	if request.RefreshToken == nil {
-		accessToken, refreshToken, err = a.service.GetTokens(request.Username, request.Password)
-	} else {
-		accessToken, refreshToken, err = a.service.RefreshAccessToken(request.RefreshToken)
+	tokens, challenge, err := grant(c, &request)
+	a.tokenResponse(c, tokens, challenge, err)
+}
+
+// respondToChallenge answers the challenge returned by the password grant
+func (a *auth) respondToChallenge(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var request entities.ChallengeRequest
+	if err := c.ShouldBind(&request); err != nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+	if request.ChallengeName == nil || request.Session == nil || request.Username == nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "challenge_name, session and username are required"))
+		return
+	}
+
+	tokens, challenge, err := a.service.RespondToChallenge(&request)
+	a.tokenResponse(c, tokens, challenge, err)
+}
+
+// logout revokes the refresh token of the request, without one or with global set
+// the user is signed out of every device and all of their tokens are revoked
+func (a *auth) logout(c *gin.Context) {
+	var request entities.LogoutRequest
+	if err := c.ShouldBind(&request); err != nil && err != io.EOF {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+	principal, _ := GetPrincipal(c)
+	if request.RefreshToken != nil {
+		if err := a.service.RevokeToken(request.RefreshToken); err != nil {
+			abortWithOAuthError(c, apiError(err))
+			return
+		}
+	}
+	global := request.RefreshToken == nil || request.Global
+	if global {
+		if err := a.service.GlobalSignOut(&principal.AccessToken); err != nil {
+			abortWithOAuthError(c, apiError(err))
+			return
+		}
 	}
+	if err := a.denyLogin(principal, global); err != nil {
+		log.Errorf("Unable to deny the tokens of %v: %v\n", principal.Username, err)
+		abortWithOAuthError(c, newOAuthError(http.StatusServiceUnavailable, "temporarily_unavailable", "the tokens could not be revoked"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// denyLogin revokes the access tokens of the caller's login, or of every login of the user when global.
+// The refresh token of the request is assumed to belong to the caller's login.
+func (a *auth) denyLogin(principal *entities.Principal, global bool) error {
+	if principal.TokenID != "" {
+		if err := a.denylist.Deny(principal.TokenID, principal.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	// The login may have refreshed tokens that expire after this one
+	if principal.OriginTokenID != "" {
+		if err := a.denylist.Deny(principal.OriginTokenID, time.Now().Add(maxAccessTokenLifetime)); err != nil {
+			return err
+		}
+	}
+	if global {
+		return denyUser(a.denylist, principal.Username)
+	}
+	return nil
+}
 
+// tokenResponse writes the tokens, or the challenge the caller must answer at /token/challenge
+func (a *auth) tokenResponse(c *gin.Context, tokens *entities.Tokens, challenge *entities.Challenge, err error) {
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":             "invalid_request",
-			"error_description": err.Error(),
+		abortWithOAuthError(c, tokenError(err))
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                "challenge_required",
+			"error_description":    "answer the " + *challenge.Name + " challenge",
+			"challenge_name":       challenge.Name,
+			"session":              challenge.Session,
+			"challenge_parameters": challenge.Parameters,
 		})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"token_type":    "bearer",
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	})
-	return
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (a *auth) passwordGrant(c *gin.Context, request *entities.TokenRequest) (*entities.Tokens, *entities.Challenge, error) {
+	if request.Username == nil || request.Password == nil {
+		return nil, nil, newOAuthError(http.StatusBadRequest, "invalid_request", "username and password are required")
+	}
+	return a.service.GetTokens(request.Username, request.Password)
+}
+
+func (a *auth) refreshTokenGrant(c *gin.Context, request *entities.TokenRequest) (*entities.Tokens, *entities.Challenge, error) {
+	if request.RefreshToken == nil {
+		return nil, nil, newOAuthError(http.StatusBadRequest, "invalid_request", "refresh_token is required")
+	}
+	tokens, err := a.service.RefreshAccessToken(request.RefreshToken)
+	return tokens, nil, err
+}
+
+func (a *auth) clientCredentialsGrant(c *gin.Context, request *entities.TokenRequest) (*entities.Tokens, *entities.Challenge, error) {
+	clientID, clientSecret, ok := clientAuthentication(c, request)
+	if !ok {
+		return nil, nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication is required")
+	}
+	tokens, err := a.service.GetClientCredentialsTokens(clientID, clientSecret, request.Scope)
+	return tokens, nil, err
+}
+
+func (a *auth) authorizationCodeGrant(c *gin.Context, request *entities.TokenRequest) (*entities.Tokens, *entities.Challenge, error) {
+	handler, ok := a.service.(entities.AuthorizationCodeHandler)
+	if !ok {
+		return nil, nil, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "grant_type authorization_code is not supported")
+	}
+	if request.Code == nil || request.RedirectURI == nil {
+		return nil, nil, newOAuthError(http.StatusBadRequest, "invalid_request", "code and redirect_uri are required")
+	}
+	tokens, err := handler.ExchangeAuthorizationCode(request.Code, request.RedirectURI, request.CodeVerifier)
+	return tokens, nil, err
+}
+
+// clientAuthentication reads the client credentials from the Basic authorization header or the request body
+func clientAuthentication(c *gin.Context, request *entities.TokenRequest) (clientID, clientSecret *string, ok bool) {
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		return &id, &secret, true
+	}
+	if request.ClientID != nil && request.ClientSecret != nil {
+		return request.ClientID, request.ClientSecret, true
+	}
+	return nil, nil, false
 }
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+// RequireGroup and RequireScope check a route regardless of the policy file, PolicyMiddleware
+// authorizes the /api routes by default. Both answer with the 403 body of abortForbidden.
+
+// RequireGroup only lets through callers in at least one of the groups (cognito:groups claim)
+func RequireGroup(groups ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+			return
+		}
+		for _, group := range groups {
+			if principal.InGroup(group) {
+				c.Next()
+				return
+			}
+		}
+		abortForbidden(c, "forbidden", fmt.Sprintf("requires membership of one of the groups: %v", strings.Join(groups, ", ")),
+			gin.H{"required_groups": groups})
+	}
+}
+
+// RequireScope only lets through callers granted all of the scopes (scope claim)
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+			return
+		}
+		missing := missingScopes(principal, scopes)
+		if len(missing) == 0 {
+			c.Next()
+			return
+		}
+		c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%v"`, strings.Join(scopes, " ")))
+		abortForbidden(c, "insufficient_scope", fmt.Sprintf("missing scopes: %v", strings.Join(missing, ", ")),
+			gin.H{"required_scopes": scopes})
+	}
+}
+
+// abortForbidden writes the structured 403 of the authorization checks, details tell what the caller lacks
+func abortForbidden(c *gin.Context, code, description string, details gin.H) {
+	body := gin.H{
+		"error":             code,
+		"error_description": description,
+	}
+	for key, value := range details {
+		body[key] = value
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, body)
+}
+
+func missingScopes(principal *entities.Principal, scopes []string) []string {
+	missing := []string{}
+	for _, scope := range scopes {
+		if !principal.HasScope(scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+// serveAs calls the check on a route as the principal, nil for an unauthenticated caller
+func serveAs(principal *entities.Principal, check gin.HandlerFunc) (*httptest.ResponseRecorder, map[string]interface{}) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/route", func(c *gin.Context) {
+		if principal != nil {
+			c.Set(principalKey, principal)
+		}
+	}, check, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/route", nil))
+	body := map[string]interface{}{}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	return recorder, body
+}
+
+func TestRequireGroup(t *testing.T) {
+	check := RequireGroup("admin", "support")
+
+	t.Run("Successfull RequireGroup", func(t *testing.T) {
+		if recorder, _ := serveAs(&entities.Principal{Username: "bob", Groups: []string{"support"}}, check); recorder.Code != http.StatusNoContent {
+			t.Errorf("Member expected to be let through, got %v", recorder.Code)
+		}
+	})
+	t.Run("Fail RequireGroup", func(t *testing.T) {
+		recorder, body := serveAs(&entities.Principal{Username: "bob", Groups: []string{"reader"}}, check)
+		if recorder.Code != http.StatusForbidden || body["error"] != "forbidden" ||
+			body["error_description"] != "requires membership of one of the groups: admin, support" {
+			t.Errorf("Structured 403 expected, got %v: %v", recorder.Code, body)
+		}
+		if groups, _ := body["required_groups"].([]interface{}); len(groups) != 2 || groups[0] != "admin" {
+			t.Errorf("Required groups expected: %v", body)
+		}
+		if recorder, _ := serveAs(nil, check); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("401 expected without a principal, got %v", recorder.Code)
+		}
+	})
+}
+
+func TestRequireScope(t *testing.T) {
+	check := RequireScope("users/read", "users/write")
+
+	t.Run("Successfull RequireScope", func(t *testing.T) {
+		principal := &entities.Principal{ClientID: "machine", Scopes: []string{"users/write", "users/read"}}
+		if recorder, _ := serveAs(principal, check); recorder.Code != http.StatusNoContent {
+			t.Errorf("Client with every scope expected to be let through, got %v", recorder.Code)
+		}
+	})
+	t.Run("Fail RequireScope", func(t *testing.T) {
+		recorder, body := serveAs(&entities.Principal{ClientID: "machine", Scopes: []string{"users/read"}}, check)
+		if recorder.Code != http.StatusForbidden || body["error"] != "insufficient_scope" || body["error_description"] != "missing scopes: users/write" {
+			t.Errorf("Structured 403 expected, got %v: %v", recorder.Code, body)
+		}
+		if header := recorder.Header().Get("WWW-Authenticate"); header != `Bearer error="insufficient_scope", scope="users/read users/write"` {
+			t.Errorf("WWW-Authenticate does not match the expected value: %v", header)
+		}
+		if recorder, _ := serveAs(nil, check); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("401 expected without a principal, got %v", recorder.Code)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+// oauthError is an RFC 6749 error response
+type oauthError struct {
+	status      int
+	code        string
+	description string
+}
+
+func newOAuthError(status int, code, description string) *oauthError {
+	return &oauthError{
+		status:      status,
+		code:        code,
+		description: description,
+	}
+}
+
+func (e *oauthError) Error() string {
+	return e.description
+}
+
+// tokenError maps the errors returned by the token handlers to RFC 6749 error responses
+func tokenError(err error) *oauthError {
+	if oerr, ok := err.(*oauthError); ok {
+		return oerr
+	}
+	if oerr, ok := err.(*entities.OAuthError); ok {
+		switch oerr.Code {
+		case "invalid_client":
+			return newOAuthError(http.StatusUnauthorized, oerr.Code, oerr.Description)
+		case "server_error":
+			return newOAuthError(http.StatusBadGateway, oerr.Code, oerr.Description)
+		}
+		return newOAuthError(http.StatusBadRequest, oerr.Code, oerr.Description)
+	}
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return newOAuthError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+	switch aerr.Code() {
+	case "NotAuthorizedException":
+		if strings.Contains(strings.ToLower(aerr.Message()), "client") {
+			return newOAuthError(http.StatusUnauthorized, "invalid_client", aerr.Message())
+		}
+		return newOAuthError(http.StatusBadRequest, "invalid_grant", aerr.Message())
+	case "UserNotFoundException", "UserNotConfirmedException", "PasswordResetRequiredException",
+		"CodeMismatchException", "ExpiredCodeException":
+		return newOAuthError(http.StatusBadRequest, "invalid_grant", aerr.Message())
+	case "ResourceNotFoundException":
+		return newOAuthError(http.StatusUnauthorized, "invalid_client", aerr.Message())
+	case "InvalidParameterException", "InvalidPasswordException", "EnableSoftwareTokenMFAException":
+		return newOAuthError(http.StatusBadRequest, "invalid_request", aerr.Message())
+	case "TooManyRequestsException", "LimitExceededException":
+		return newOAuthError(http.StatusTooManyRequests, "temporarily_unavailable", aerr.Message())
+	}
+	return newOAuthError(http.StatusInternalServerError, "server_error", aerr.Message())
+}
+
+func abortWithOAuthError(c *gin.Context, err *oauthError) {
+	if err.code == "invalid_client" {
+		c.Header("WWW-Authenticate", `Basic realm="token"`)
+	}
+	body := gin.H{"error": err.code}
+	if err.description != "" {
+		body["error_description"] = err.description
+	}
+	c.AbortWithStatusJSON(err.status, body)
+}
+
+// apiError maps the errors returned by the user handlers to a status and a stable error code
+func apiError(err error) *oauthError {
+	if oerr, ok := err.(*oauthError); ok {
+		return oerr
+	}
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return newOAuthError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+	switch aerr.Code() {
+	case "NotAuthorizedException":
+		return newOAuthError(http.StatusUnauthorized, "not_authorized", aerr.Message())
+	case "UserNotFoundException":
+		return newOAuthError(http.StatusNotFound, "user_not_found", aerr.Message())
+	case "ResourceNotFoundException":
+		return newOAuthError(http.StatusNotFound, "not_found", aerr.Message())
+	case "GroupExistsException":
+		return newOAuthError(http.StatusConflict, "group_exists", aerr.Message())
+	case "UsernameExistsException", "AliasExistsException":
+		return newOAuthError(http.StatusConflict, "username_exists", aerr.Message())
+	case "CodeMismatchException", "EnableSoftwareTokenMFAException":
+		return newOAuthError(http.StatusBadRequest, "code_mismatch", aerr.Message())
+	case "ExpiredCodeException":
+		return newOAuthError(http.StatusBadRequest, "expired_code", aerr.Message())
+	case "UnsupportedUserStateException":
+		return newOAuthError(http.StatusConflict, "unsupported_user_state", aerr.Message())
+	case "SoftwareTokenMFANotFoundException":
+		return newOAuthError(http.StatusConflict, "mfa_not_enrolled", aerr.Message())
+	case "InvalidPasswordException":
+		return newOAuthError(http.StatusBadRequest, "invalid_password", aerr.Message())
+	case "InvalidParameterException":
+		return newOAuthError(http.StatusBadRequest, "invalid_request", aerr.Message())
+	case "TooManyRequestsException", "LimitExceededException":
+		return newOAuthError(http.StatusTooManyRequests, "too_many_requests", aerr.Message())
+	}
+	return newOAuthError(http.StatusInternalServerError, "server_error", aerr.Message())
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+type groups struct {
+	service    entities.GroupAdmin
+	users      entities.UserAdmin
+	attributes []string
+	denylist   entities.TokenDenylist
+}
+
+// NewGroups manages the groups granting the roles, its routes must be restricted to administrators by the policy.
+// Only the user attributes in the allowlist are exposed. The tokens of the users added to or removed from a group
+// are added to the denylist, so their groups are read again at the next login.
+func NewGroups(service entities.GroupAdmin, users entities.UserAdmin, attributes []string, denylist entities.TokenDenylist) *groups {
+	return &groups{
+		service:    service,
+		users:      users,
+		attributes: attributes,
+		denylist:   denylist,
+	}
+}
+
+func (g *groups) RegisterGroupRoutes(router *gin.RouterGroup) {
+	router.GET("/groups", g.listGroups)
+	router.POST("/groups", g.createGroup)
+	router.DELETE("/groups/:group", g.deleteGroup)
+	router.GET("/groups/:group/users", g.listUsersInGroup)
+	router.PUT("/groups/:group/users/:username", g.addUserToGroup)
+	router.DELETE("/groups/:group/users/:username", g.removeUserFromGroup)
+	router.GET("/users/:username/groups", g.listGroupsForUser)
+}
+
+func (g *groups) listGroups(c *gin.Context) {
+	request, ok := bindPageRequest(c)
+	if !ok {
+		return
+	}
+	page, err := g.service.ListGroups(request)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (g *groups) createGroup(c *gin.Context) {
+	var request entities.CreateGroupRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Name == nil || *request.Name == "" {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "name is required"))
+		return
+	}
+	group, err := g.service.CreateGroup(&request)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.JSON(http.StatusCreated, group)
+}
+
+func (g *groups) deleteGroup(c *gin.Context) {
+	if err := g.service.DeleteGroup(groupParam(c)); err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (g *groups) listUsersInGroup(c *gin.Context) {
+	request, ok := bindPageRequest(c)
+	if !ok {
+		return
+	}
+	page, err := g.service.ListUsersInGroup(groupParam(c), request)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	for i := range page.Users {
+		page.Users[i].RestrictAttributes(g.attributes)
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (g *groups) addUserToGroup(c *gin.Context) {
+	revokeTokens(c, g.users, g.denylist, func(username *string) error {
+		return g.service.AddUserToGroup(username, groupParam(c))
+	})
+}
+
+func (g *groups) removeUserFromGroup(c *gin.Context) {
+	revokeTokens(c, g.users, g.denylist, func(username *string) error {
+		return g.service.RemoveUserFromGroup(username, groupParam(c))
+	})
+}
+
+func (g *groups) listGroupsForUser(c *gin.Context) {
+	request, ok := bindPageRequest(c)
+	if !ok {
+		return
+	}
+	page, err := g.service.ListGroupsForUser(usernameParam(c), request)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func bindPageRequest(c *gin.Context) (*entities.PageRequest, bool) {
+	var request entities.PageRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return nil, false
+	}
+	return &request, true
+}
+
+func groupParam(c *gin.Context) *string {
+	group := c.Param("group")
+	return &group
+}
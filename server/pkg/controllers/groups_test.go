@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	"github.com/paujim/cognitoserver/server/pkg/services"
+)
+
+// memberships records the memberships changed as username/group
+type memberships struct {
+	entities.GroupAdmin
+	changed []string
+}
+
+func (m *memberships) AddUserToGroup(username, group *string) error {
+	m.changed = append(m.changed, *username+"/"+*group)
+	return nil
+}
+
+func (m *memberships) RemoveUserFromGroup(username, group *string) error {
+	m.changed = append(m.changed, *username+"/"+*group)
+	return nil
+}
+
+func TestGroupMembershipRevokeTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		t.Run("Successfull "+method+" membership by alias", func(t *testing.T) {
+			service := &memberships{}
+			denylist := services.NewTokenDenylist()
+			router := gin.New()
+			NewGroups(service, &aliasedUsers{}, []string{"email"}, denylist).RegisterGroupRoutes(router.Group("/api/admin"))
+
+			issued := time.Now().Add(-time.Minute)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(method, "/api/admin/groups/admin/users/bob@example.com", nil))
+			if recorder.Code != http.StatusNoContent {
+				t.Fatalf("204 expected, got %v: %v", recorder.Code, recorder.Body.String())
+			}
+			if len(service.changed) != 1 || service.changed[0] != "bob/admin" {
+				t.Errorf("Membership of the canonical username expected: %v", service.changed)
+			}
+			if denied, _ := denylist.Denied(entities.DeniedUserKey("bob"), issued); !denied {
+				t.Errorf("Tokens issued with the former groups expected to be denied")
+			}
+		})
+	}
+	t.Run("Fail changing the membership of an unknown user", func(t *testing.T) {
+		service := &memberships{}
+		router := gin.New()
+		NewGroups(service, &aliasedUsers{}, []string{"email"}, services.NewTokenDenylist()).RegisterGroupRoutes(router.Group("/api/admin"))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/api/admin/groups/admin/users/carol", nil))
+		if recorder.Code != http.StatusNotFound || len(service.changed) != 0 {
+			t.Errorf("404 expected, got %v", recorder.Code)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// RegisterIntrospectionRoutes serves RFC 7662 to the app clients of the pool,
+// and to the callers presenting apiKey in the X-API-Key header when it is set
+func (a *auth) RegisterIntrospectionRoutes(router *gin.RouterGroup, apiKey string) {
+	a.introspectionKey = apiKey
+	router.POST("/introspect", a.introspect)
+}
+
+// introspect reports whether an access token is active, that is valid and not revoked.
+// Refresh tokens are opaque and always reported inactive.
+func (a *auth) introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var request entities.IntrospectionRequest
+	if err := c.ShouldBind(&request); err != nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+	if err := a.authenticateIntrospection(c, &request); err != nil {
+		abortWithOAuthError(c, tokenError(err))
+		return
+	}
+	if request.Token == nil || *request.Token == "" {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "token is required"))
+		return
+	}
+
+	token, err := a.validateToken(*request.Token)
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusOK, entities.Introspection{})
+		return
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	principal := a.principalFromClaims(claims)
+	revoked, err := a.revoked(principal)
+	if err != nil {
+		log.Errorf("Unable to check the token denylist: %v\n", err)
+		abortWithOAuthError(c, newOAuthError(http.StatusServiceUnavailable, "temporarily_unavailable", "the token could not be checked"))
+		return
+	}
+	if revoked {
+		c.JSON(http.StatusOK, entities.Introspection{})
+		return
+	}
+	introspection := entities.Introspection{
+		Active:    true,
+		Subject:   principal.Subject,
+		Username:  principal.Username,
+		Scope:     claimString(claims, "scope"),
+		ClientID:  principal.ClientID,
+		TokenType: "Bearer",
+	}
+	// A missing claim is left out rather than reported as the Unix time of the zero time
+	if !principal.ExpiresAt.IsZero() {
+		introspection.ExpiresAt = principal.ExpiresAt.Unix()
+	}
+	if !principal.IssuedAt.IsZero() {
+		introspection.IssuedAt = principal.IssuedAt.Unix()
+	}
+	c.JSON(http.StatusOK, introspection)
+}
+
+// authenticateIntrospection accepts the API key, or the credentials of an app client
+func (a *auth) authenticateIntrospection(c *gin.Context, request *entities.IntrospectionRequest) error {
+	if key := c.GetHeader(apiKeyHeader); key != "" {
+		if a.introspectionKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(a.introspectionKey)) != 1 {
+			return newOAuthError(http.StatusUnauthorized, "invalid_client", "invalid API key")
+		}
+		return nil
+	}
+	clientID, clientSecret, ok := clientAuthentication(c, &entities.TokenRequest{ClientID: request.ClientID, ClientSecret: request.ClientSecret})
+	if !ok {
+		return newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication is required")
+	}
+	authenticator, ok := a.service.(entities.ClientAuthenticator)
+	if !ok {
+		return newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication is not supported")
+	}
+	return authenticator.AuthenticateClient(clientID, clientSecret)
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/services"
+)
+
+// staticKeys serves a single signing key under any kid
+type staticKeys struct {
+	key *rsa.PublicKey
+}
+
+func (s *staticKeys) GetKey(string) (*rsa.PublicKey, error) {
+	return s.key, nil
+}
+
+func (s *staticKeys) Close() {}
+
+func TestIntrospect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	denylist := services.NewTokenDenylist()
+	router := gin.New()
+	NewAuth("us-west-2", "us-west-2_test", nil, &staticKeys{key: &key.PublicKey}, denylist).RegisterIntrospectionRoutes(router.Group("/api"), "k3y")
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":        "https://cognito-idp.us-west-2.amazonaws.com/us-west-2_test",
+			"sub":        "bob-sub",
+			"username":   "bob",
+			"client_id":  "client",
+			"token_use":  "access",
+			"scope":      "aws.cognito.signin.user.admin",
+			"exp":        time.Now().Add(time.Hour).Unix(),
+			"iat":        time.Now().Add(-time.Minute).Unix(),
+			"jti":        "jti",
+			"origin_jti": "origin",
+		}
+	}
+	introspect := func(apiKey, token string) (int, map[string]interface{}) {
+		request := httptest.NewRequest(http.MethodPost, "/api/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set(apiKeyHeader, apiKey)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		body := map[string]interface{}{}
+		json.Unmarshal(recorder.Body.Bytes(), &body)
+		return recorder.Code, body
+	}
+
+	t.Run("Successfull introspection of an active token", func(t *testing.T) {
+		status, body := introspect("k3y", sign(claims()))
+		if status != http.StatusOK || body["active"] != true || body["username"] != "bob" || body["token_type"] != "Bearer" {
+			t.Fatalf("Active token expected, got %v: %v", status, body)
+		}
+		if iat, ok := body["iat"].(float64); !ok || iat <= 0 {
+			t.Errorf("iat expected: %v", body)
+		}
+	})
+	t.Run("Successfull introspection of a token without iat", func(t *testing.T) {
+		withoutIat := claims()
+		delete(withoutIat, "iat")
+		status, body := introspect("k3y", sign(withoutIat))
+		if status != http.StatusOK || body["active"] != true {
+			t.Fatalf("Active token expected, got %v: %v", status, body)
+		}
+		if _, ok := body["iat"]; ok {
+			t.Errorf("No iat expected: %v", body)
+		}
+		if exp, ok := body["exp"].(float64); !ok || exp <= 0 {
+			t.Errorf("exp expected: %v", body)
+		}
+	})
+	t.Run("Successfull introspection of a revoked token", func(t *testing.T) {
+		if err := denylist.Deny("origin", time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		status, body := introspect("k3y", sign(claims()))
+		if status != http.StatusOK || len(body) != 1 || body["active"] != false {
+			t.Errorf("Inactive token expected, got %v: %v", status, body)
+		}
+	})
+	t.Run("Fail introspection with a wrong API key", func(t *testing.T) {
+		if status, body := introspect("wrong", sign(claims())); status != http.StatusUnauthorized || body["error"] != "invalid_client" {
+			t.Errorf("invalid_client expected, got %v: %v", status, body)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const qrCodeSize = 256
+
+type mfa struct {
+	service entities.MFAHandler
+	issuer  string
+}
+
+// NewMFA manages the authenticator app of the caller, issuer is the name shown in the app
+func NewMFA(service entities.MFAHandler, issuer string) *mfa {
+	return &mfa{
+		service: service,
+		issuer:  issuer,
+	}
+}
+
+func (m *mfa) RegisterMFARoutes(router *gin.RouterGroup) {
+	router.Use(requireUser)
+	router.GET("", m.getSettings)
+	// Enrolling again replaces the authenticator app once the new one is verified
+	router.POST("/totp", m.associate)
+	router.POST("/totp/verify", m.verify)
+	router.DELETE("/totp", m.disable)
+}
+
+// requireUser rejects app clients, the Cognito APIs acting as the user need a user access token
+func requireUser(c *gin.Context) {
+	principal, ok := GetPrincipal(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+		return
+	}
+	if principal.IsClient() {
+		abortForbidden(c, "forbidden", "requires a user access token", nil)
+		return
+	}
+	c.Next()
+}
+
+func (m *mfa) getSettings(c *gin.Context) {
+	principal, _ := GetPrincipal(c)
+	settings, err := m.service.GetMFASettings(&principal.AccessToken)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (m *mfa) associate(c *gin.Context) {
+	principal, _ := GetPrincipal(c)
+	secretCode, err := m.service.AssociateSoftwareToken(&principal.AccessToken)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+
+	uri := provisioningURI(m.issuer, principal.Username, *secretCode)
+	png, err := qrcode.Encode(uri, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		log.Errorf("Fail to render QR code: %v\n", err.Error())
+		abortWithOAuthError(c, newOAuthError(http.StatusInternalServerError, "server_error", ""))
+		return
+	}
+	// The secret must not end up in any cache
+	c.Header("Cache-Control", "no-store")
+	if c.NegotiateFormat(gin.MIMEJSON, "image/png") == "image/png" {
+		c.Data(http.StatusOK, "image/png", png)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret_code": secretCode,
+		"otpauth_uri": uri,
+		"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// verify confirms the enrollment and makes the authenticator app the preferred MFA
+func (m *mfa) verify(c *gin.Context) {
+	principal, _ := GetPrincipal(c)
+	var request entities.MFAVerificationRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "code is required"))
+		return
+	}
+	if err := m.service.VerifySoftwareToken(&principal.AccessToken, request.Code, request.DeviceName); err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	if err := m.service.SetSoftwareTokenMFAPreference(&principal.AccessToken, true, true); err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	m.getSettings(c)
+}
+
+func (m *mfa) disable(c *gin.Context) {
+	principal, _ := GetPrincipal(c)
+	if err := m.service.SetSoftwareTokenMFAPreference(&principal.AccessToken, false, false); err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	m.getSettings(c)
+}
+
+// provisioningURI is the otpauth:// URI authenticator apps enroll from (Key Uri Format)
+func provisioningURI(issuer, account, secret string) string {
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {"6"},
+		"period":    {"30"},
+	}
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	oauthLoginCookie = "oauth_login"
+	oauthLoginTTL    = 10 * time.Minute
+)
+
+// OAuthConfig configures the login through the Cognito hosted UI
+type OAuthConfig struct {
+	// ClientID is the app client the ID tokens must be issued to
+	ClientID string
+	// CallbackURL is the public URL of /api/oauth/callback, registered on the app client
+	CallbackURL string
+	// ClientURL is where the React client receives the tokens, in the URL fragment
+	ClientURL string
+	// Scope requested from the hosted UI, e.g. "openid email profile"
+	Scope string
+}
+
+// oauthLogin is kept in a cookie between the authorize redirect and the callback
+type oauthLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func (a *auth) RegisterOAuthRoutes(router *gin.RouterGroup, config OAuthConfig) {
+	a.oauth = config
+	router.GET("/oauth/authorize", a.authorize)
+	router.GET("/oauth/callback", a.callback)
+}
+
+func (a *auth) authorize(c *gin.Context) {
+	handler, ok := a.service.(entities.AuthorizationCodeHandler)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "unsupported_response_type"})
+		return
+	}
+
+	login := &oauthLogin{
+		State:    randomURLSafe(32),
+		Nonce:    randomURLSafe(32),
+		Verifier: randomURLSafe(32),
+	}
+	authorizationURL, err := handler.AuthorizationURL(&entities.AuthorizationRequest{
+		RedirectURI:      a.oauth.CallbackURL,
+		State:            login.State,
+		Nonce:            login.Nonce,
+		CodeChallenge:    codeChallenge(login.Verifier),
+		Scope:            a.oauth.Scope,
+		IdentityProvider: c.Query("identity_provider"),
+	})
+	if err != nil {
+		abortWithOAuthError(c, tokenError(err))
+		return
+	}
+
+	a.setLoginCookie(c, login, int(oauthLoginTTL.Seconds()))
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, authorizationURL)
+}
+
+func (a *auth) callback(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	login, err := a.loginFromCookie(c)
+	a.setLoginCookie(c, nil, -1)
+
+	if errorCode := c.Query("error"); errorCode != "" {
+		a.redirectToClient(c, url.Values{"error": {errorCode}, "error_description": {c.Query("error_description")}})
+		return
+	}
+	handler, ok := a.service.(entities.AuthorizationCodeHandler)
+	if !ok {
+		a.redirectToClient(c, url.Values{"error": {"unsupported_response_type"}})
+		return
+	}
+	if err != nil {
+		log.Warnf("OAuth callback without a valid login: %v\n", err.Error())
+		a.redirectToClient(c, url.Values{"error": {"invalid_request"}, "error_description": {"login expired, please try again"}})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(login.State)) != 1 {
+		a.redirectToClient(c, url.Values{"error": {"invalid_request"}, "error_description": {"state does not match"}})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		a.redirectToClient(c, url.Values{"error": {"invalid_request"}, "error_description": {"code is required"}})
+		return
+	}
+
+	tokens, err := handler.ExchangeAuthorizationCode(&code, &a.oauth.CallbackURL, &login.Verifier)
+	if err != nil {
+		oerr := tokenError(err)
+		a.redirectToClient(c, url.Values{"error": {oerr.code}, "error_description": {oerr.description}})
+		return
+	}
+	if tokens.IDToken == nil {
+		a.redirectToClient(c, url.Values{"error": {"invalid_scope"}, "error_description": {"openid scope is required"}})
+		return
+	}
+	if err := a.validateIDToken(*tokens.IDToken, login.Nonce); err != nil {
+		log.Warnf("Invalid ID token from the hosted UI: %v\n", err.Error())
+		a.redirectToClient(c, url.Values{"error": {"invalid_token"}})
+		return
+	}
+
+	fragment := url.Values{
+		"access_token": {*tokens.AccessToken},
+		"id_token":     {*tokens.IDToken},
+		"token_type":   {"Bearer"},
+	}
+	if tokens.RefreshToken != nil {
+		fragment.Set("refresh_token", *tokens.RefreshToken)
+	}
+	if tokens.ExpiresIn != nil {
+		fragment.Set("expires_in", strconv.FormatInt(*tokens.ExpiresIn, 10))
+	}
+	if tokens.Scope != nil {
+		fragment.Set("scope", *tokens.Scope)
+	}
+	a.redirectToClient(c, fragment)
+}
+
+// validateIDToken checks the ID token was issued by the user pool to our app client for this login
+func (a *auth) validateIDToken(tokenStr, nonce string) error {
+	token, err := a.parseToken(tokenStr, "id")
+	if err != nil {
+		return err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if err = a.validateClaimItem("aud", []string{a.oauth.ClientID}, claims); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(claimString(claims, "nonce")), []byte(nonce)) != 1 {
+		return errors.New("nonce does not match")
+	}
+	return nil
+}
+
+// redirectToClient hands the result to the React client in the URL fragment, which is never sent to servers
+func (a *auth) redirectToClient(c *gin.Context, fragment url.Values) {
+	c.Redirect(http.StatusFound, a.oauth.ClientURL+"#"+fragment.Encode())
+}
+
+func (a *auth) setLoginCookie(c *gin.Context, login *oauthLogin, maxAge int) {
+	value := ""
+	if login != nil {
+		data, _ := json.Marshal(login)
+		value = base64.RawURLEncoding.EncodeToString(data)
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oauthLoginCookie,
+		Value:    value,
+		Path:     c.Request.URL.Path[:strings.LastIndex(c.Request.URL.Path, "/")],
+		MaxAge:   maxAge,
+		Secure:   strings.HasPrefix(a.oauth.CallbackURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (a *auth) loginFromCookie(c *gin.Context) (*oauthLogin, error) {
+	value, err := c.Cookie(oauthLoginCookie)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	login := &oauthLogin{}
+	if err = json.Unmarshal(data, login); err != nil {
+		return nil, err
+	}
+	if login.State == "" || login.Nonce == "" || !validCodeVerifier(login.Verifier) {
+		return nil, fmt.Errorf("incomplete login")
+	}
+	return login, nil
+}
+
+// codeChallenge is the S256 PKCE challenge of the verifier (RFC 7636)
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func validCodeVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, r := range verifier {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func randomURLSafe(length int) string {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+type password struct {
+	service entities.PasswordHandler
+	limiter entities.RateLimiter
+}
+
+// NewPassword serves the password change of the caller and the password reset of users who forgot it,
+// throttled per username and client IP
+func NewPassword(service entities.PasswordHandler, limiter entities.RateLimiter) *password {
+	return &password{
+		service: service,
+		limiter: limiter,
+	}
+}
+
+func (p *password) RegisterPasswordRoutes(router *gin.RouterGroup) {
+	router.POST("/forgot", p.forgotPassword)
+	router.POST("/confirm", p.confirmForgotPassword)
+}
+
+// RegisterChangePasswordRoutes registers the routes of the caller, behind AuthMiddleware
+func (p *password) RegisterChangePasswordRoutes(router *gin.RouterGroup) {
+	router.POST("/password", requireUser, p.changePassword)
+}
+
+func (p *password) changePassword(c *gin.Context) {
+	principal, _ := GetPrincipal(c)
+	var request entities.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.CurrentPassword == nil || request.NewPassword == nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "current_password and new_password are required"))
+		return
+	}
+
+	err := p.service.ChangePassword(&principal.AccessToken, request.CurrentPassword, request.NewPassword)
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "password_changed"})
+		return
+	}
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotAuthorizedException" {
+		// The token was already validated, Cognito rejected the current password
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "incorrect_password", aerr.Message()))
+		return
+	}
+	abortWithOAuthError(c, apiError(err))
+}
+
+// forgotPassword answers the same whether the username exists or not
+func (p *password) forgotPassword(c *gin.Context) {
+	var request entities.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Username == nil || *request.Username == "" {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "username is required"))
+		return
+	}
+	if !allowAttempt(c, p.limiter, *request.Username) {
+		return
+	}
+
+	err := p.service.ForgotPassword(request.Username)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "TooManyRequestsException" {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	if err != nil {
+		// Unknown, unverified or throttled users must look like any other
+		log.Warnf("Fail to send forgot password code: %v\n", err.Error())
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "requested",
+		"message": "if the account exists, a code to reset the password has been sent",
+	})
+}
+
+func (p *password) confirmForgotPassword(c *gin.Context) {
+	var request entities.ConfirmForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Username == nil || request.Code == nil || request.NewPassword == nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "username, code and new_password are required"))
+		return
+	}
+	if !allowAttempt(c, p.limiter, *request.Username) {
+		return
+	}
+
+	err := p.service.ConfirmForgotPassword(request.Username, request.Code, request.NewPassword)
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "password_reset"})
+		return
+	}
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidPasswordException" {
+		// The password policy does not depend on the user
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	// Any other failure (unknown user, expired code, limit exceeded...) gets the answer of a wrong code
+	// so the response does not tell whether the username exists
+	log.Warnf("Fail to confirm forgot password: %v\n", err.Error())
+	abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "code_mismatch", "Invalid verification code provided, please try again."))
+}
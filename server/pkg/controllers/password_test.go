@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	"github.com/paujim/cognitoserver/server/pkg/services"
+)
+
+// failingPassword fails every ConfirmForgotPassword with err
+type failingPassword struct {
+	entities.PasswordHandler
+	err error
+}
+
+func (f *failingPassword) ConfirmForgotPassword(username, code, newPassword *string) error {
+	return f.err
+}
+
+func TestConfirmForgotPassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	confirm := func(err error) *httptest.ResponseRecorder {
+		router := gin.New()
+		NewPassword(&failingPassword{err: err}, services.NewRateLimiter(10, time.Minute)).RegisterPasswordRoutes(router.Group("/api/password"))
+		body := `{"username":"bob","code":"123456","new_password":"new password"}`
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/password/confirm", strings.NewReader(body)))
+		return recorder
+	}
+
+	for _, code := range []string{"CodeMismatchException", "UserNotFoundException", "NotAuthorizedException", "ExpiredCodeException", "LimitExceededException"} {
+		t.Run("Fail confirm with "+code+" as a code mismatch", func(t *testing.T) {
+			recorder := confirm(awserr.New(code, "message of "+code, nil))
+			expected := `{"error":"code_mismatch","error_description":"Invalid verification code provided, please try again."}`
+			if recorder.Code != http.StatusBadRequest || strings.TrimSpace(recorder.Body.String()) != expected {
+				t.Errorf("Uniform code mismatch expected, got %v: %v", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+	t.Run("Fail confirm with a password outside the policy", func(t *testing.T) {
+		recorder := confirm(awserr.New("InvalidPasswordException", "Password not long enough", nil))
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "Password not long enough") {
+			t.Errorf("Password policy error expected, got %v: %v", recorder.Code, recorder.Body.String())
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+// PolicyMiddleware authorizes every request against the policy.
+// In dry run denials are only logged and the request goes through.
+func PolicyMiddleware(policy entities.PolicyEvaluator, dryRun bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+			return
+		}
+		allowed, reason := policy.Evaluate(principal, c.Request.Method, c.Request.URL.Path)
+		if allowed {
+			c.Next()
+			return
+		}
+
+		fields := log.Fields{
+			"sub":       principal.Subject,
+			"client_id": principal.ClientID,
+			"method":    c.Request.Method,
+			"path":      c.Request.URL.Path,
+			"dry_run":   dryRun,
+		}
+		log.WithFields(fields).Warnf("Policy denied request: %v\n", reason)
+		if dryRun {
+			c.Next()
+			return
+		}
+		abortForbidden(c, "forbidden", reason, nil)
+	}
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+type signUp struct {
+	service entities.SignUpHandler
+	limiter entities.RateLimiter
+	enabled bool
+}
+
+// NewSignUp serves the public self-registration and its confirmation, throttled per username and client IP.
+// When not enabled new users can only be created by an administrator.
+func NewSignUp(service entities.SignUpHandler, limiter entities.RateLimiter, enabled bool) *signUp {
+	return &signUp{
+		service: service,
+		limiter: limiter,
+		enabled: enabled,
+	}
+}
+
+func (s *signUp) RegisterSignUpRoutes(router *gin.RouterGroup) {
+	router.POST("", s.registerUser)
+	router.POST("/confirm", s.confirmSignUp)
+	router.POST("/resend", s.resendConfirmationCode)
+}
+
+func (s *signUp) registerUser(c *gin.Context) {
+	if !s.enabled {
+		abortWithOAuthError(c, newOAuthError(http.StatusForbidden, "signup_disabled", "self-registration is disabled"))
+		return
+	}
+	var request entities.RegistrationRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Username == nil || request.Password == nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "username and password are required"))
+		return
+	}
+	if !allowAttempt(c, s.limiter, *request.Username) {
+		return
+	}
+	registration, err := s.service.RegisterUser(&request)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":                "registered",
+		"sub":                   registration.Sub,
+		"user_confirmed":        registration.UserConfirmed,
+		"code_delivery_details": registration.CodeDeliveryDetails,
+	})
+}
+
+func (s *signUp) confirmSignUp(c *gin.Context) {
+	var request entities.ConfirmSignUpRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Username == nil || request.Code == nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "username and code are required"))
+		return
+	}
+	if !allowAttempt(c, s.limiter, *request.Username) {
+		return
+	}
+	if err := s.service.ConfirmSignUp(request.Username, request.Code); err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "confirmed"})
+}
+
+func (s *signUp) resendConfirmationCode(c *gin.Context) {
+	var request entities.ResendConfirmationCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Username == nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "username is required"))
+		return
+	}
+	if !allowAttempt(c, s.limiter, *request.Username) {
+		return
+	}
+	delivery, err := s.service.ResendConfirmationCode(request.Username)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":                "code_sent",
+		"code_delivery_details": delivery,
+	})
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+// allowAttempt throttles the attempts on the username and from the client IP.
+// The IP is the remote address unless the router trusts the proxy headers (ForwardedByClientIP).
+func allowAttempt(c *gin.Context, limiter entities.RateLimiter, username string) bool {
+	for _, key := range []string{"ip:" + c.ClientIP(), "username:" + strings.ToLower(username)} {
+		if ok, retryAfter := limiter.Allow(key); !ok {
+			c.Header("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+			abortWithOAuthError(c, newOAuthError(http.StatusTooManyRequests, "too_many_requests", "too many attempts, try again later"))
+			return false
+		}
+	}
+	return true
+}
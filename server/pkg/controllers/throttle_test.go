@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/services"
+)
+
+func TestAllowAttempt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	attempt := func(router *gin.Engine, username, forwardedFor string) int {
+		request := httptest.NewRequest(http.MethodPost, "/attempt?username="+username, nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		request.Header.Set("X-Forwarded-For", forwardedFor)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	newRouter := func(trustProxy bool) *gin.Engine {
+		router := gin.New()
+		router.ForwardedByClientIP = trustProxy
+		limiter := services.NewRateLimiter(2, time.Minute)
+		router.POST("/attempt", func(c *gin.Context) {
+			if allowAttempt(c, limiter, c.Query("username")) {
+				c.Status(http.StatusNoContent)
+			}
+		})
+		return router
+	}
+
+	t.Run("Fail attempts from the same connection with spoofed headers", func(t *testing.T) {
+		router := newRouter(false)
+		for i := 0; i < 2; i++ {
+			if code := attempt(router, "user"+strconv.Itoa(i), "203.0.113."+strconv.Itoa(i)); code != http.StatusNoContent {
+				t.Fatalf("Attempt %v expected to be allowed, got %v", i, code)
+			}
+		}
+		if code := attempt(router, "user2", "203.0.113.2"); code != http.StatusTooManyRequests {
+			t.Errorf("Attempt over the limit of the IP expected to be throttled, got %v", code)
+		}
+	})
+	t.Run("Successfull attempts through a trusted proxy", func(t *testing.T) {
+		router := newRouter(true)
+		for i := 0; i < 3; i++ {
+			if code := attempt(router, "user"+strconv.Itoa(i), "203.0.113."+strconv.Itoa(i)); code != http.StatusNoContent {
+				t.Errorf("Attempt %v from another client expected to be allowed, got %v", i, code)
+			}
+		}
+	})
+}
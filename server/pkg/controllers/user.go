@@ -2,47 +2,58 @@ package controllers
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/paujim/cognitoserver/server/pkg/entities"
 )
 
 type user struct {
-	service entities.UserHandler
+	service    entities.UserHandler
+	attributes []string
 }
 
-func NewUser(service entities.UserHandler) *user {
+// NewUser only exposes the user attributes in the allowlist
+func NewUser(service entities.UserHandler, attributes []string) *user {
 	return &user{
-		service: service,
+		service:    service,
+		attributes: attributes,
 	}
 }
 
 func (u *user) RegisterUserRoutes(router *gin.RouterGroup) {
-	router.POST("/register", u.registerUser)
 	router.GET("/list", u.listUsers)
 }
 
-func (u *user) registerUser(c *gin.Context) {
-	var request entities.RegistrationRequest
-	c.BindJSON(&request)
-	sub, err := u.service.RegisterUser(request.Username, request.Password)
-	if err == nil {
-		c.JSON(http.StatusAccepted, gin.H{
-			"status": "registered",
-			"sub":    sub,
-		})
+func (u *user) listUsers(c *gin.Context) {
+	var request entities.ListUsersRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-	return
-}
+	request.Attributes = splitAttributes(request.Attributes)
 
-func (u *user) listUsers(c *gin.Context) {
-	users, err := u.service.ListUsers()
+	page, err := u.service.ListUsers(&request)
 	if err == nil {
-		c.JSON(http.StatusOK, gin.H{"users": users})
+		for i := range page.Users {
+			page.Users[i].RestrictAttributes(u.attributes)
+		}
+		c.JSON(http.StatusOK, page)
 		return
 	}
 	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 	return
 }
+
+// splitAttributes reads the attributes query parameter, which can be repeated or comma separated
+func splitAttributes(values []string) []string {
+	attributes := []string{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				attributes = append(attributes, name)
+			}
+		}
+	}
+	return attributes
+}
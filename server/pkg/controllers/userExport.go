@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+type userExport struct {
+	service    entities.UserHandler
+	attributes []string
+}
+
+// NewUserExport exports the user pool, its routes must be restricted to administrators by the policy.
+// Only the user attributes in the allowlist are exported.
+func NewUserExport(service entities.UserHandler, attributes []string) *userExport {
+	return &userExport{
+		service:    service,
+		attributes: attributes,
+	}
+}
+
+func (u *userExport) RegisterUserExportRoutes(router *gin.RouterGroup) {
+	router.GET("/export/users", u.exportUsers)
+}
+
+// userWriter writes the users of a page, Flush sends them to the client
+type userWriter interface {
+	Write(user *entities.UserModel) error
+	Flush() error
+}
+
+// exportUsers streams every page of users as CSV or JSON Lines, taking the filter,
+// attributes and include_groups query parameters of the list endpoint
+func (u *userExport) exportUsers(c *gin.Context) {
+	var request entities.ListUsersRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+	request.Limit = nil
+	request.Cursor = nil
+	request.Attributes = splitAttributes(request.Attributes)
+	for _, name := range request.Attributes {
+		if !entities.AttributeAllowed(u.attributes, name) {
+			abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "attribute "+name+" cannot be exported"))
+			return
+		}
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "jsonl" {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "format must be csv or jsonl"))
+		return
+	}
+
+	// The first page is read before answering, so that an invalid filter is still a 400
+	page, err := u.service.ListUsers(&request)
+	if err != nil {
+		abortWithOAuthError(c, apiError(err))
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="users-`+time.Now().UTC().Format("20060102T150405Z")+"."+format+`"`)
+	var writer userWriter
+	if format == "csv" {
+		columns := request.Attributes
+		if len(columns) == 0 {
+			// Without a selection the custom attributes are only exported when named in the allowlist
+			for _, name := range u.attributes {
+				if name != entities.CustomAttributePrefix+"*" {
+					columns = append(columns, name)
+				}
+			}
+		}
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		writer = newCSVUserWriter(c.Writer, columns, request.IncludeGroups)
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		writer = &jsonLinesUserWriter{response: c.Writer, encoder: json.NewEncoder(c.Writer)}
+	}
+	c.Status(http.StatusOK)
+	if err = u.streamUsers(c, &request, page, writer); err != nil {
+		u.abortExport(c, format, err)
+	}
+}
+
+// streamUsers writes the first page and reads the next ones, every page is flushed to the client
+func (u *userExport) streamUsers(c *gin.Context, request *entities.ListUsersRequest, page *entities.UserPage, writer userWriter) (err error) {
+	exported := 0
+	for {
+		for i := range page.Users {
+			page.Users[i].RestrictAttributes(u.attributes)
+			if err = writer.Write(&page.Users[i]); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			break
+		}
+		exported += len(page.Users)
+		if page.NextCursor == nil {
+			break
+		}
+		request.Cursor = page.NextCursor
+		if page, err = u.service.ListUsers(request); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		log.Errorf("User export stopped after %v users: %v\n", exported, err.Error())
+	}
+	return
+}
+
+// abortExport tells the client the export is incomplete, the status is already sent.
+// JSON Lines end with an error record, CSV has no room for one so the connection is closed
+// before the end of the chunked body.
+func (u *userExport) abortExport(c *gin.Context, format string, err error) {
+	if format == "jsonl" {
+		oerr := apiError(err)
+		json.NewEncoder(c.Writer).Encode(gin.H{"error": oerr.code, "error_description": oerr.description})
+		c.Writer.Flush()
+		return
+	}
+	conn, _, herr := c.Writer.Hijack()
+	if herr != nil {
+		log.Errorf("Unable to abort the user export: %v\n", herr)
+		return
+	}
+	conn.Close()
+}
+
+type csvUserWriter struct {
+	response gin.ResponseWriter
+	writer   *csv.Writer
+	columns  []string
+	groups   bool
+}
+
+// newCSVUserWriter writes the header row, the groups are joined with |
+func newCSVUserWriter(response gin.ResponseWriter, columns []string, groups bool) *csvUserWriter {
+	w := &csvUserWriter{
+		response: response,
+		writer:   csv.NewWriter(response),
+		columns:  columns,
+		groups:   groups,
+	}
+	header := append([]string{"username", "status", "enabled", "created", "last_modified"}, columns...)
+	if groups {
+		header = append(header, "groups")
+	}
+	// An error is reported by the next Flush
+	w.writer.Write(header)
+	return w
+}
+
+func (w *csvUserWriter) Write(user *entities.UserModel) error {
+	record := []string{
+		stringOrEmpty(user.Username),
+		stringOrEmpty(user.Status),
+		"",
+		timeOrEmpty(user.Created),
+		timeOrEmpty(user.LastModified),
+	}
+	if user.Enabled != nil {
+		record[2] = strconv.FormatBool(*user.Enabled)
+	}
+	for _, name := range w.columns {
+		value, _ := user.Attribute(name)
+		record = append(record, value)
+	}
+	if w.groups {
+		record = append(record, strings.Join(user.Groups, "|"))
+	}
+	for i, field := range record {
+		record[i] = escapeFormula(field)
+	}
+	return w.writer.Write(record)
+}
+
+// escapeFormula prefixes with a quote the fields a spreadsheet would run as a formula
+func escapeFormula(field string) string {
+	if field != "" && strings.ContainsAny(field[:1], "=+-@\t\r") {
+		return "'" + field
+	}
+	return field
+}
+
+func (w *csvUserWriter) Flush() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return err
+	}
+	w.response.Flush()
+	return nil
+}
+
+type jsonLinesUserWriter struct {
+	response gin.ResponseWriter
+	encoder  *json.Encoder
+}
+
+func (w *jsonLinesUserWriter) Write(user *entities.UserModel) error {
+	return w.encoder.Encode(user)
+}
+
+func (w *jsonLinesUserWriter) Flush() error {
+	w.response.Flush()
+	return nil
+}
+
+func stringOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func timeOrEmpty(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+// pagedUsers serves the pages in turn, the cursor is the index of the page.
+// The page at failAt (when set) fails with TooManyRequestsException.
+type pagedUsers struct {
+	entities.UserHandler
+	pages    []entities.UserPage
+	failAt   int
+	requests []entities.ListUsersRequest
+}
+
+func (p *pagedUsers) ListUsers(request *entities.ListUsersRequest) (*entities.UserPage, error) {
+	p.requests = append(p.requests, *request)
+	index := 0
+	if request.Cursor != nil {
+		index, _ = strconv.Atoi(*request.Cursor)
+	}
+	if p.failAt > 0 && index == p.failAt {
+		return nil, awserr.New("TooManyRequestsException", "Too many requests", nil)
+	}
+	page := p.pages[index]
+	if index+1 < len(p.pages) {
+		page.NextCursor = aws.String(strconv.Itoa(index + 1))
+	}
+	return &page, nil
+}
+
+func newTestExportRouter(service entities.UserHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	attributes := []string{"email", "name"}
+	router := gin.New()
+	NewUserExport(service, attributes).RegisterUserExportRoutes(router.Group("/api/admin"))
+	return router
+}
+
+func exportUser(username, email string, groups ...string) entities.UserModel {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return entities.UserModel{
+		Username:         aws.String(username),
+		Status:           aws.String("CONFIRMED"),
+		Enabled:          aws.Bool(true),
+		Created:          &created,
+		Email:            aws.String(email),
+		CustomAttributes: map[string]string{"team": "blue"},
+		Groups:           groups,
+	}
+}
+
+func testPages() []entities.UserPage {
+	return []entities.UserPage{
+		{Users: []entities.UserModel{exportUser("alice", "alice@example.com", "admin"), exportUser("bob", "bob@example.com")}},
+		{Users: []entities.UserModel{exportUser("carol", "carol,c@example.com", "admin", "reader")}},
+		{Users: []entities.UserModel{exportUser("dave", "=HYPERLINK(\"http://example.com\")")}},
+	}
+}
+
+func serveGet(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestExportUsers(t *testing.T) {
+
+	t.Run("Successfull export as CSV across pages", func(t *testing.T) {
+		service := &pagedUsers{pages: testPages()}
+		recorder := serveGet(newTestExportRouter(service), "/api/admin/export/users?include_groups=true")
+		if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/csv") {
+			t.Fatalf("CSV expected, got %v: %v", recorder.Code, recorder.Body.String())
+		}
+		expected := "username,status,enabled,created,last_modified,email,name,groups\n" +
+			"alice,CONFIRMED,true,2026-01-02T03:04:05Z,,alice@example.com,,admin\n" +
+			"bob,CONFIRMED,true,2026-01-02T03:04:05Z,,bob@example.com,,\n" +
+			"carol,CONFIRMED,true,2026-01-02T03:04:05Z,,\"carol,c@example.com\",,admin|reader\n" +
+			"dave,CONFIRMED,true,2026-01-02T03:04:05Z,,\"'=HYPERLINK(\"\"http://example.com\"\")\",,\n"
+		if recorder.Body.String() != expected {
+			t.Errorf("CSV does not match the expected value:\n%v", recorder.Body.String())
+		}
+		if len(service.requests) != 3 || *service.requests[2].Cursor != "2" {
+			t.Errorf("Every page expected to be read: %+v", service.requests)
+		}
+	})
+	t.Run("Successfull export as JSON Lines", func(t *testing.T) {
+		recorder := serveGet(newTestExportRouter(&pagedUsers{pages: testPages()}), "/api/admin/export/users?format=jsonl")
+		if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("JSON Lines expected, got %v: %v", recorder.Code, recorder.Body.String())
+		}
+		lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("4 users expected, got %v", len(lines))
+		}
+		var user entities.UserModel
+		if err := json.Unmarshal([]byte(lines[2]), &user); err != nil {
+			t.Fatal(err)
+		}
+		if *user.Username != "carol" || *user.Email != "carol,c@example.com" || user.CustomAttributes != nil {
+			t.Errorf("User does not match the expected value: %v", lines[2])
+		}
+	})
+	t.Run("Successfull export passes the filters through", func(t *testing.T) {
+		service := &pagedUsers{pages: testPages()[:1]}
+		recorder := serveGet(newTestExportRouter(service), "/api/admin/export/users?filter=email+%5E%3D+%22a%22&attributes=email&limit=5&cursor=1")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Export expected, got %v: %v", recorder.Code, recorder.Body.String())
+		}
+		request := service.requests[0]
+		if *request.Filter != `email ^= "a"` || len(request.Attributes) != 1 || request.Attributes[0] != "email" {
+			t.Errorf("Filters expected to be passed through: %+v", request)
+		}
+		if request.Limit != nil || request.Cursor != nil {
+			t.Errorf("Export expected to start from the first page: %+v", request)
+		}
+		if !strings.HasPrefix(recorder.Body.String(), "username,status,enabled,created,last_modified,email\n") {
+			t.Errorf("Only the selected attributes expected: %v", recorder.Body.String())
+		}
+	})
+	t.Run("Fail export with attribute outside the allowlist", func(t *testing.T) {
+		service := &pagedUsers{pages: testPages()}
+		recorder := serveGet(newTestExportRouter(service), "/api/admin/export/users?attributes=email,custom:team")
+		if recorder.Code != http.StatusBadRequest || len(service.requests) != 0 {
+			t.Errorf("400 expected before reading the users, got %v", recorder.Code)
+		}
+	})
+	t.Run("Fail export before the first row", func(t *testing.T) {
+		recorder := serveGet(newTestExportRouter(&failingUsers{}), "/api/admin/export/users")
+		if recorder.Code != http.StatusTooManyRequests {
+			t.Errorf("Error status expected, got %v", recorder.Code)
+		}
+	})
+	t.Run("Fail export as JSON Lines with a trailing error record", func(t *testing.T) {
+		recorder := serveGet(newTestExportRouter(&pagedUsers{pages: testPages(), failAt: 2}), "/api/admin/export/users?format=jsonl")
+		lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		if len(lines) != 4 || lines[3] != `{"error":"too_many_requests","error_description":"Too many requests"}` {
+			t.Errorf("Error record expected after the users: %v", lines)
+		}
+	})
+	t.Run("Fail export as CSV with a truncated response", func(t *testing.T) {
+		server := httptest.NewServer(newTestExportRouter(&pagedUsers{pages: testPages(), failAt: 2}))
+		defer server.Close()
+		resp, err := http.Get(server.URL + "/api/admin/export/users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err == nil {
+			t.Errorf("Truncated response expected, got %q", body)
+		}
+		if !strings.Contains(string(body), "carol") {
+			t.Errorf("Rows of the pages read expected before the failure: %q", body)
+		}
+	})
+}
+
+// failingUsers fails every ListUsers
+type failingUsers struct {
+	entities.UserHandler
+}
+
+func (f *failingUsers) ListUsers(*entities.ListUsersRequest) (*entities.UserPage, error) {
+	return nil, awserr.New("TooManyRequestsException", "Too many requests", nil)
+}
+
+func TestEscapeFormula(t *testing.T) {
+	for _, field := range []string{"=1+1", "+15550100", "-1", "@SUM(A1)", "\tx", "\rx"} {
+		if escaped := escapeFormula(field); escaped != "'"+field {
+			t.Errorf("Field %q expected to be escaped, got %q", field, escaped)
+		}
+	}
+	for _, field := range []string{"", "alice", "a=b", "'quoted"} {
+		if escaped := escapeFormula(field); escaped != field {
+			t.Errorf("Field %q expected as is, got %q", field, escaped)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+const (
+	maxImportSize = 10 << 20
+	maxImportRows = 10000
+)
+
+type userImport struct {
+	service entities.UserImporter
+}
+
+// NewUserImport creates users in bulk, its routes must be restricted to administrators by the policy
+func NewUserImport(service entities.UserImporter) *userImport {
+	return &userImport{
+		service: service,
+	}
+}
+
+func (u *userImport) RegisterUserImportRoutes(router *gin.RouterGroup) {
+	router.POST("/import/users", u.importUsers)
+}
+
+// importUsers reads the file from the body, or the file field of a multipart form.
+// The format query parameter (csv or jsonl) defaults to the one of the content type or file name.
+func (u *userImport) importUsers(c *gin.Context) {
+	options := entities.ImportOptions{}
+	options.DryRun, _ = strconv.ParseBool(c.Query("dry_run"))
+	if messageAction := c.Query("message_action"); messageAction != "" {
+		if messageAction != "SUPPRESS" && messageAction != "RESEND" {
+			abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "message_action must be SUPPRESS or RESEND"))
+			return
+		}
+		options.MessageAction = &messageAction
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	var file io.Reader = c.Request.Body
+	format := c.Query("format")
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	if mediaType == "multipart/form-data" {
+		header, err := c.FormFile("file")
+		if err != nil {
+			abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", "file is required"))
+			return
+		}
+		part, err := header.Open()
+		if err != nil {
+			abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+			return
+		}
+		defer part.Close()
+		file = part
+		mediaType = mime.TypeByExtension(filepath.Ext(header.Filename))
+		if mediaType == "" {
+			mediaType = strings.TrimPrefix(filepath.Ext(header.Filename), ".")
+		}
+	}
+	if format == "" {
+		format = importFormat(mediaType)
+	}
+
+	rows, err := u.service.ReadUsers(file, format)
+	if err != nil {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+	if len(rows) > maxImportRows {
+		abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", fmt.Sprintf("at most %v users can be imported at once", maxImportRows)))
+		return
+	}
+	c.JSON(http.StatusOK, u.service.ImportUsers(rows, options))
+}
+
+// importFormat is the import format of a media type or file extension
+func importFormat(mediaType string) string {
+	switch strings.Split(mediaType, ";")[0] {
+	case "text/csv", "csv":
+		return "csv"
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines", "jsonl", "ndjson":
+		return "jsonl"
+	}
+	return mediaType
+}
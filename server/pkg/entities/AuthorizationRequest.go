@@ -0,0 +1,11 @@
+package entities
+
+// AuthorizationRequest is sent to the authorization endpoint to start the authorization code flow
+type AuthorizationRequest struct {
+	RedirectURI      string
+	State            string
+	Nonce            string
+	CodeChallenge    string
+	Scope            string
+	IdentityProvider string
+}
@@ -0,0 +1,26 @@
+package entities
+
+// Challenge is returned instead of tokens when the user pool needs more from the user to log in
+type Challenge struct {
+	Name       *string            `json:"challenge_name"`
+	Session    *string            `json:"session"`
+	Parameters map[string]*string `json:"challenge_parameters,omitempty"`
+}
+
+// ChallengeRequest answers a challenge, the fields used depend on the challenge:
+//
+//	SMS_MFA, SOFTWARE_TOKEN_MFA: Code
+//	SELECT_MFA_TYPE: MFAType (SMS_MFA or SOFTWARE_TOKEN_MFA)
+//	MFA_SETUP: nothing to get the secret to enroll, then Code from the authenticator app
+//	NEW_PASSWORD_REQUIRED: NewPassword and the required Attributes
+//	CUSTOM_CHALLENGE: Answer
+type ChallengeRequest struct {
+	ChallengeName *string           `form:"challenge_name" json:"challenge_name"`
+	Session       *string           `form:"session" json:"session"`
+	Username      *string           `form:"username" json:"username"`
+	Code          *string           `form:"code" json:"code"`
+	MFAType       *string           `form:"mfa_type" json:"mfa_type"`
+	NewPassword   *string           `form:"new_password" json:"new_password"`
+	Answer        *string           `form:"answer" json:"answer"`
+	Attributes    map[string]string `json:"attributes"`
+}
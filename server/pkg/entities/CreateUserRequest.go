@@ -0,0 +1,15 @@
+package entities
+
+// CreateUserRequest creates a user as an administrator, the user sets its password on first login
+type CreateUserRequest struct {
+	Username          *string `json:"username"`
+	TemporaryPassword *string `json:"temporary_password"`
+	Email             *string `json:"email"`
+	PhoneNumber       *string `json:"phone_number"`
+	// Attributes are the other attributes of the user, such as name or custom:team
+	Attributes map[string]string `json:"attributes"`
+	// MessageAction is SUPPRESS to send no invitation, or RESEND to invite an existing user again
+	MessageAction *string `json:"message_action"`
+	// DesiredDeliveryMediums are EMAIL and/or SMS, defaults to SMS
+	DesiredDeliveryMediums []string `json:"desired_delivery_mediums"`
+}
@@ -0,0 +1,25 @@
+package entities
+
+import "time"
+
+// Group is a Cognito group, the groups of a user grant its roles through the cognito:groups claim
+type Group struct {
+	Name         *string    `json:"name"`
+	Description  *string    `json:"description,omitempty"`
+	Precedence   *int64     `json:"precedence,omitempty"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+// CreateGroupRequest creates a group, the lowest precedence wins when a user is in several groups
+type CreateGroupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Precedence  *int64  `json:"precedence"`
+}
+
+// GroupPage is a page of groups, NextCursor is set when there are more
+type GroupPage struct {
+	Groups     []Group `json:"groups"`
+	NextCursor *string `json:"next_cursor,omitempty"`
+}
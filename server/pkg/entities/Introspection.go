@@ -0,0 +1,22 @@
+package entities
+
+// IntrospectionRequest is an RFC 7662 request, the caller authenticates with its client credentials
+// (Basic authorization or the form) or an API key
+type IntrospectionRequest struct {
+	Token         *string `form:"token"`
+	TokenTypeHint *string `form:"token_type_hint"`
+	ClientID      *string `form:"client_id"`
+	ClientSecret  *string `form:"client_secret"`
+}
+
+// Introspection is an RFC 7662 response, an inactive token only has Active set
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+}
@@ -0,0 +1,30 @@
+package entities
+
+import (
+	"crypto/rsa"
+	"time"
+)
+
+type JSONWebKey struct {
+	Alg string `json:"alg"`
+	E   string `json:"e"`
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	Use string `json:"use"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type KeyProvider interface {
+	GetKey(kid string) (*rsa.PublicKey, error)
+	Close()
+}
+
+type KeySource interface {
+	// FetchKeys returns the current key set and until when it may be cached.
+	// A zero expires means the source does not say.
+	FetchKeys() (jwks *JSONWebKeySet, expires time.Time, err error)
+}
@@ -0,0 +1,19 @@
+package entities
+
+// ListUsersRequest selects a page of users.
+// Filter is a Cognito filter expression such as `email ^= "a"` or `cognito:user_status = "UNCONFIRMED"`,
+// status is the user status as in the user model, not Enabled or Disabled as in Cognito.
+// IncludeGroups adds the groups of each user, which costs a request per user.
+type ListUsersRequest struct {
+	Limit         *int64   `form:"limit"`
+	Cursor        *string  `form:"cursor"`
+	Filter        *string  `form:"filter"`
+	Attributes    []string `form:"attributes"`
+	IncludeGroups bool     `form:"include_groups"`
+}
+
+// UserPage is a page of users, NextCursor is set when there are more
+type UserPage struct {
+	Users      []UserModel `json:"users"`
+	NextCursor *string     `json:"next_cursor,omitempty"`
+}
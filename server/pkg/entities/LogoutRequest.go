@@ -0,0 +1,7 @@
+package entities
+
+// LogoutRequest revokes the refresh token, Global (or no refresh token) signs the user out of every device
+type LogoutRequest struct {
+	RefreshToken *string `form:"refresh_token" json:"refresh_token"`
+	Global       bool    `form:"global" json:"global"`
+}
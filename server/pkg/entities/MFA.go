@@ -0,0 +1,19 @@
+package entities
+
+// MFASettings are the MFA methods enabled for a user and the one used at login
+type MFASettings struct {
+	Enabled   []string `json:"enabled"`
+	Preferred *string  `json:"preferred,omitempty"`
+}
+
+// MFAVerificationRequest confirms the enrollment of an authenticator app with a code it generated
+type MFAVerificationRequest struct {
+	Code       *string `json:"code"`
+	DeviceName *string `json:"device_name"`
+}
+
+// MFAOption is an SMS MFA setting of the legacy MFAOptions
+type MFAOption struct {
+	DeliveryMedium *string `json:"delivery_medium"`
+	AttributeName  *string `json:"attribute_name"`
+}
@@ -0,0 +1,7 @@
+package entities
+
+// PageRequest selects a page of a listing, Cursor is the NextCursor of the previous page
+type PageRequest struct {
+	Limit  *int64  `form:"limit"`
+	Cursor *string `form:"cursor"`
+}
@@ -0,0 +1,16 @@
+package entities
+
+type ForgotPasswordRequest struct {
+	Username *string `json:"username"`
+}
+
+type ConfirmForgotPasswordRequest struct {
+	Username    *string `json:"username"`
+	Code        *string `json:"code"`
+	NewPassword *string `json:"new_password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword *string `json:"current_password"`
+	NewPassword     *string `json:"new_password"`
+}
@@ -0,0 +1,27 @@
+package entities
+
+// Policy describes which roles may call which routes
+type Policy struct {
+	Roles       map[string]Role `json:"roles" yaml:"roles"`
+	Permissions []Permission    `json:"permissions" yaml:"permissions"`
+}
+
+// Role is granted to callers in any of the groups or holding any of the scopes
+type Role struct {
+	Groups []string `json:"groups" yaml:"groups"`
+	Scopes []string `json:"scopes" yaml:"scopes"`
+}
+
+// Permission allows the roles to call the routes with the methods.
+// Route patterns match one path segment with "*" or ":name" and any remaining segments with a trailing "**".
+type Permission struct {
+	Roles   []string `json:"roles" yaml:"roles"`
+	Methods []string `json:"methods" yaml:"methods"`
+	Routes  []string `json:"routes" yaml:"routes"`
+}
+
+type PolicyEvaluator interface {
+	Evaluate(principal *Principal, method, path string) (allowed bool, reason string)
+	Reload() error
+	Close()
+}
@@ -0,0 +1,58 @@
+package entities
+
+import (
+	"context"
+	"time"
+)
+
+// Principal is the caller authenticated by an access token.
+// Machine-to-machine callers (client_credentials grant) have no Username.
+type Principal struct {
+	Subject   string    `json:"sub"`
+	Username  string    `json:"username,omitempty"`
+	ClientID  string    `json:"client_id"`
+	Groups    []string  `json:"groups,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	AuthTime  time.Time `json:"auth_time"`
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp"`
+	// TokenID (jti) and OriginTokenID (origin_jti, shared by the tokens of a login) are the keys of the TokenDenylist
+	TokenID       string `json:"jti,omitempty"`
+	OriginTokenID string `json:"origin_jti,omitempty"`
+	// AccessToken is the raw bearer token, needed by the Cognito APIs acting as the user
+	AccessToken string `json:"-"`
+}
+
+// IsClient reports whether the caller is an app client rather than a user
+func (p *Principal) IsClient() bool {
+	return p.Username == ""
+}
+
+func (p *Principal) InGroup(group string) bool {
+	for _, g := range p.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalContextKey struct{}
+
+func NewContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok
+}
@@ -0,0 +1,9 @@
+package entities
+
+import "time"
+
+// RateLimiter throttles the attempts made under a key, e.g. a username or a client IP
+type RateLimiter interface {
+	// Allow records an attempt, when it is over the limit retryAfter tells when to try again
+	Allow(key string) (ok bool, retryAfter time.Duration)
+}
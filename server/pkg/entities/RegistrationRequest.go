@@ -1,6 +1,31 @@
 package entities
 
 type RegistrationRequest struct {
+	Username    *string `json:"username"`
+	Password    *string `json:"password"`
+	Email       *string `json:"email"`
+	PhoneNumber *string `json:"phone_number"`
+}
+
+// Registration is the outcome of a sign up, unconfirmed users must confirm the code sent to them
+type Registration struct {
+	Sub                 *string              `json:"sub"`
+	UserConfirmed       *bool                `json:"user_confirmed"`
+	CodeDeliveryDetails *CodeDeliveryDetails `json:"code_delivery_details,omitempty"`
+}
+
+// CodeDeliveryDetails tells where a confirmation code was sent, the destination is masked
+type CodeDeliveryDetails struct {
+	Destination    *string `json:"destination"`
+	DeliveryMedium *string `json:"delivery_medium"`
+	AttributeName  *string `json:"attribute_name"`
+}
+
+type ConfirmSignUpRequest struct {
+	Username *string `json:"username"`
+	Code     *string `json:"code"`
+}
+
+type ResendConfirmationCodeRequest struct {
 	Username *string `json:"username"`
-	Password *string `json:"password"`
 }
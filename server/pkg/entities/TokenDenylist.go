@@ -0,0 +1,19 @@
+package entities
+
+import "time"
+
+// TokenDenylist holds the revoked access tokens until they expire, they stay valid JWTs until then.
+// Several instances of the server must share the store to refuse the same tokens.
+type TokenDenylist interface {
+	// Deny revokes the tokens of the key issued until now, the entry can be dropped after expiresAt
+	Deny(key string, expiresAt time.Time) error
+	// Denied reports whether a token of the key issued at issuedAt is revoked. iat has a second precision,
+	// so the tokens issued in the second of the denial are not, even the ones issued just before it.
+	// A zero issuedAt checks the key whatever the issue time.
+	Denied(key string, issuedAt time.Time) (bool, error)
+}
+
+// DeniedUserKey is the denylist key of every token of a user, the other keys are the jti and origin_jti claims
+func DeniedUserKey(username string) string {
+	return "user:" + username
+}
@@ -1,7 +1,14 @@
 package entities
 
 type TokenRequest struct {
+	GrantType    *string `form:"grant_type"`
 	Username     *string `form:"username"`
 	Password     *string `form:"password"`
 	RefreshToken *string `form:"refresh_token"`
+	Scope        *string `form:"scope"`
+	ClientID     *string `form:"client_id"`
+	ClientSecret *string `form:"client_secret"`
+	Code         *string `form:"code"`
+	RedirectURI  *string `form:"redirect_uri"`
+	CodeVerifier *string `form:"code_verifier"`
 }
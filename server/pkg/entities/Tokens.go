@@ -0,0 +1,10 @@
+package entities
+
+type Tokens struct {
+	AccessToken  *string `json:"access_token"`
+	IDToken      *string `json:"id_token,omitempty"`
+	RefreshToken *string `json:"refresh_token,omitempty"`
+	TokenType    *string `json:"token_type"`
+	ExpiresIn    *int64  `json:"expires_in,omitempty"`
+	Scope        *string `json:"scope,omitempty"`
+}
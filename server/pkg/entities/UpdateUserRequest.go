@@ -0,0 +1,6 @@
+package entities
+
+// UpdateUserRequest changes the attributes of a user, a null value deletes the attribute
+type UpdateUserRequest struct {
+	Attributes map[string]*string `json:"attributes"`
+}
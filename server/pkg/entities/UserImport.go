@@ -0,0 +1,46 @@
+package entities
+
+import "io"
+
+// Statuses of the users of an import
+const (
+	ImportStatusCreated = "created"
+	ImportStatusSkipped = "skipped"
+	ImportStatusFailed  = "failed"
+)
+
+// ImportRow is a user read from an import file, Invalid explains why it cannot be imported
+type ImportRow struct {
+	Line    int
+	User    *CreateUserRequest
+	Invalid string
+}
+
+// ImportOptions apply to every user of an import, a dry run only validates the users
+type ImportOptions struct {
+	DryRun        bool
+	MessageAction *string
+}
+
+// ImportResult is the outcome of a row, Reason explains why it was skipped or failed
+type ImportResult struct {
+	Line     int     `json:"line"`
+	Username *string `json:"username,omitempty"`
+	Status   string  `json:"status"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+// ImportReport counts the users that were, or in a dry run would be, created
+type ImportReport struct {
+	DryRun  bool           `json:"dry_run"`
+	Created int            `json:"created"`
+	Skipped int            `json:"skipped"`
+	Failed  int            `json:"failed"`
+	Results []ImportResult `json:"results"`
+}
+
+// UserImporter creates users in bulk from a CSV or JSON Lines file
+type UserImporter interface {
+	ReadUsers(reader io.Reader, format string) (rows []ImportRow, err error)
+	ImportUsers(rows []ImportRow, options ImportOptions) *ImportReport
+}
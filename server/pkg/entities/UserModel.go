@@ -1,10 +1,119 @@
 package entities
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CustomAttributePrefix starts the name of the attributes defined by the user pool
+const CustomAttributePrefix = "custom:"
 
 type UserModel struct {
-	Username *string    `json:"username"`
-	Status   *string    `json:"status"`
-	Enabled  *bool      `json:"enabled"`
-	Created  *time.Time `json:"created"`
+	Username     *string    `json:"username"`
+	Status       *string    `json:"status"`
+	Enabled      *bool      `json:"enabled"`
+	Created      *time.Time `json:"created"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+
+	Sub           *string `json:"sub,omitempty"`
+	Email         *string `json:"email,omitempty"`
+	EmailVerified *bool   `json:"email_verified,omitempty"`
+	PhoneNumber   *string `json:"phone_number,omitempty"`
+	Name          *string `json:"name,omitempty"`
+	// CustomAttributes are the custom:* attributes, keyed without the prefix
+	CustomAttributes map[string]string `json:"custom_attributes,omitempty"`
+
+	MFAOptions []MFAOption `json:"mfa_options,omitempty"`
+	// Groups are only set when requested
+	Groups []string `json:"groups,omitempty"`
+}
+
+// SetAttribute maps a Cognito attribute to the model, other standard attributes are ignored
+func (u *UserModel) SetAttribute(name, value string) {
+	switch name {
+	case "sub":
+		u.Sub = &value
+	case "email":
+		u.Email = &value
+	case "email_verified":
+		verified, _ := strconv.ParseBool(value)
+		u.EmailVerified = &verified
+	case "phone_number":
+		u.PhoneNumber = &value
+	case "name":
+		u.Name = &value
+	default:
+		if strings.HasPrefix(name, CustomAttributePrefix) {
+			if u.CustomAttributes == nil {
+				u.CustomAttributes = map[string]string{}
+			}
+			u.CustomAttributes[strings.TrimPrefix(name, CustomAttributePrefix)] = value
+		}
+	}
+}
+
+// Attribute is the value of an attribute set by SetAttribute
+func (u *UserModel) Attribute(name string) (value string, ok bool) {
+	switch name {
+	case "sub":
+		return stringValue(u.Sub)
+	case "email":
+		return stringValue(u.Email)
+	case "email_verified":
+		if u.EmailVerified == nil {
+			return "", false
+		}
+		return strconv.FormatBool(*u.EmailVerified), true
+	case "phone_number":
+		return stringValue(u.PhoneNumber)
+	case "name":
+		return stringValue(u.Name)
+	}
+	value, ok = u.CustomAttributes[strings.TrimPrefix(name, CustomAttributePrefix)]
+	return value, ok && strings.HasPrefix(name, CustomAttributePrefix)
+}
+
+func stringValue(value *string) (string, bool) {
+	if value == nil {
+		return "", false
+	}
+	return *value, true
+}
+
+// RestrictAttributes drops the attributes not in the allowlist
+func (u *UserModel) RestrictAttributes(allowlist []string) {
+	if !AttributeAllowed(allowlist, "sub") {
+		u.Sub = nil
+	}
+	if !AttributeAllowed(allowlist, "email") {
+		u.Email = nil
+	}
+	if !AttributeAllowed(allowlist, "email_verified") {
+		u.EmailVerified = nil
+	}
+	if !AttributeAllowed(allowlist, "phone_number") {
+		u.PhoneNumber = nil
+	}
+	if !AttributeAllowed(allowlist, "name") {
+		u.Name = nil
+	}
+	for name := range u.CustomAttributes {
+		if !AttributeAllowed(allowlist, CustomAttributePrefix+name) {
+			delete(u.CustomAttributes, name)
+		}
+	}
+	if len(u.CustomAttributes) == 0 {
+		u.CustomAttributes = nil
+	}
+}
+
+// AttributeAllowed tells if the allowlist has the attribute, "custom:*" allows every custom attribute
+func AttributeAllowed(allowlist []string, name string) bool {
+	for _, allowed := range allowlist {
+		if allowed == name || (allowed == CustomAttributePrefix+"*" && strings.HasPrefix(name, CustomAttributePrefix)) {
+			return true
+		}
+	}
+	return false
 }
@@ -1,16 +1,99 @@
 package entities
 
 type TokenHandler interface {
-	GetTokens(username, password *string) (accessToken, refreshToken *string, err error)
-	RefreshAccessToken(token *string) (accessToken, refreshToken *string, err error)
+	// GetTokens returns either the tokens or the challenge to answer with RespondToChallenge
+	GetTokens(username, password *string) (tokens *Tokens, challenge *Challenge, err error)
+	RespondToChallenge(request *ChallengeRequest) (tokens *Tokens, challenge *Challenge, err error)
+	RefreshAccessToken(token *string) (tokens *Tokens, err error)
+	ClientCredentialsHandler
+	SignOutHandler
+}
+
+// SignOutHandler ends sessions, the access tokens already issued stay valid for other verifiers until they expire
+type SignOutHandler interface {
+	// RevokeToken revokes a refresh token and the access tokens issued with it
+	RevokeToken(refreshToken *string) error
+	// GlobalSignOut revokes every refresh token of the user of the access token
+	GlobalSignOut(accessToken *string) error
+	// AdminGlobalSignOut revokes every refresh token of a user on behalf of an administrator
+	AdminGlobalSignOut(username *string) error
+}
+
+// ClientCredentialsHandler issues tokens to machine-to-machine callers, they carry no username
+type ClientCredentialsHandler interface {
+	GetClientCredentialsTokens(clientID, clientSecret, scope *string) (tokens *Tokens, err error)
+}
+
+// ClientAuthenticator verifies the credentials of the app clients of the pool, e.g. the callers of the introspection
+type ClientAuthenticator interface {
+	AuthenticateClient(clientID, clientSecret *string) error
+}
+
+// AuthorizationCodeHandler is implemented by token handlers supporting the authorization_code grant
+// through the hosted UI (and the federated identity providers behind it)
+type AuthorizationCodeHandler interface {
+	AuthorizationURL(request *AuthorizationRequest) (url string, err error)
+	ExchangeAuthorizationCode(code, redirectURI, codeVerifier *string) (tokens *Tokens, err error)
+}
+
+// SignUpHandler registers users through the public sign up, they confirm it with a code sent to them
+type SignUpHandler interface {
+	RegisterUser(request *RegistrationRequest) (registration *Registration, err error)
+	ConfirmSignUp(username, code *string) (err error)
+	ResendConfirmationCode(username *string) (delivery *CodeDeliveryDetails, err error)
 }
 
 type UserHandler interface {
-	RegisterUser(username, password *string) (sub *string, err error)
-	ListUsers() (users []UserModel, err error)
+	SignUpHandler
+	ListUsers(request *ListUsersRequest) (page *UserPage, err error)
+}
+
+// UserAdmin manages the users of the pool on behalf of an administrator
+type UserAdmin interface {
+	CreateUser(request *CreateUserRequest) (user *UserModel, err error)
+	GetUser(username *string) (user *UserModel, err error)
+	UpdateUserAttributes(username *string, attributes map[string]string) error
+	DeleteUserAttributes(username *string, names []string) error
+	DeleteUser(username *string) error
+	EnableUser(username *string) error
+	DisableUser(username *string) error
+}
+
+// GroupAdmin manages the groups of the pool and their members on behalf of an administrator
+type GroupAdmin interface {
+	ListGroups(request *PageRequest) (page *GroupPage, err error)
+	CreateGroup(request *CreateGroupRequest) (group *Group, err error)
+	DeleteGroup(name *string) error
+	AddUserToGroup(username, group *string) error
+	RemoveUserFromGroup(username, group *string) error
+	ListGroupsForUser(username *string, request *PageRequest) (page *GroupPage, err error)
+	ListUsersInGroup(group *string, request *PageRequest) (page *UserPage, err error)
+	// UserGroups lists every group of the user
+	UserGroups(username *string) (groups []string, err error)
+}
+
+// MFAHandler manages the authenticator app (TOTP) of the signed in user, identified by its access token
+type MFAHandler interface {
+	// AssociateSoftwareToken starts an enrollment (or a re-enrollment) and returns the secret to share with the app
+	AssociateSoftwareToken(accessToken *string) (secretCode *string, err error)
+	VerifySoftwareToken(accessToken, code, deviceName *string) (err error)
+	SetSoftwareTokenMFAPreference(accessToken *string, enabled, preferred bool) (err error)
+	GetMFASettings(accessToken *string) (settings *MFASettings, err error)
+}
+
+// PasswordHandler changes the password of the signed in user, identified by its access token,
+// and resets the password of users who forgot it with a code sent to them
+type PasswordHandler interface {
+	ChangePassword(accessToken, currentPassword, newPassword *string) (err error)
+	ForgotPassword(username *string) (err error)
+	ConfirmForgotPassword(username, code, newPassword *string) (err error)
 }
 
 type UserTokenHandler interface {
 	TokenHandler
 	UserHandler
+	UserAdmin
+	GroupAdmin
+	MFAHandler
+	PasswordHandler
 }
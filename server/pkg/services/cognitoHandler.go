@@ -1,11 +1,18 @@
 package services
 
 import (
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider/cognitoidentityprovideriface"
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/paujim/cognitoserver/server/pkg/entities"
 	log "github.com/sirupsen/logrus"
 )
@@ -14,6 +21,9 @@ var (
 	ErrorInvalidInputParameters = errors.New("Missing input parameters")
 )
 
+// clientSecretTTL is how long the secrets of the app clients are cached, DescribeUserPoolClient has a low quota
+const clientSecretTTL = 5 * time.Minute
+
 func init() {
 	log.SetFormatter(&log.JSONFormatter{})
 }
@@ -22,23 +32,75 @@ type cognitoHandler struct {
 	appClientID *string
 	userPoolID  *string
 	cognitoAPI  cognitoidentityprovideriface.CognitoIdentityProviderAPI
+	oauth2      *oauth2Client
+
+	authorizeURL string
+	srpAuth      bool
+	// sleep waits between the retries of the throttled requests
+	sleep func(time.Duration)
+
+	clientSecretsMu sync.Mutex
+	clientSecrets   map[string]cachedClientSecret
+}
+
+type cachedClientSecret struct {
+	secret  string
+	expires time.Time
+}
+
+// CognitoOption configures the optional features of the cognito handler
+type CognitoOption func(*cognitoHandler)
+
+// WithTokenURL enables the grants served by the OAuth 2.0 token endpoint,
+// usually https://<domain>.auth.<region>.amazoncognito.com/oauth2/token
+func WithTokenURL(tokenURL string) CognitoOption {
+	return func(c *cognitoHandler) {
+		c.oauth2 = newOAuth2Client(tokenURL)
+	}
+}
+
+// WithAuthorizeURL enables the hosted UI login (authorization code grant with PKCE),
+// usually https://<domain>.auth.<region>.amazoncognito.com/oauth2/authorize
+func WithAuthorizeURL(authorizeURL string) CognitoOption {
+	return func(c *cognitoHandler) {
+		c.authorizeURL = authorizeURL
+	}
+}
+
+// WithSRPAuth logs users in with USER_SRP_AUTH, so the password is never sent to Cognito.
+// The app client must allow ALLOW_USER_SRP_AUTH.
+func WithSRPAuth() CognitoOption {
+	return func(c *cognitoHandler) {
+		c.srpAuth = true
+	}
 }
 
-func NewCognitoHandler(appClientID, userPoolID string, client cognitoidentityprovideriface.CognitoIdentityProviderAPI) entities.UserTokenHandler {
-	return &cognitoHandler{
+func NewCognitoHandler(appClientID, userPoolID string, client cognitoidentityprovideriface.CognitoIdentityProviderAPI, options ...CognitoOption) entities.UserTokenHandler {
+	c := &cognitoHandler{
 		appClientID: aws.String(appClientID),
 		userPoolID:  aws.String(userPoolID),
 		cognitoAPI:  client,
+		sleep:       time.Sleep,
+
+		clientSecrets: map[string]cachedClientSecret{},
+	}
+	for _, option := range options {
+		option(c)
 	}
+	return c
 }
 
-func (c *cognitoHandler) GetTokens(username, password *string) (accessToken, refreshToken *string, err error) {
+func (c *cognitoHandler) GetTokens(username, password *string) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
 
 	if username == nil || password == nil {
 		err = ErrorInvalidInputParameters
 		return
 	}
 
+	if c.srpAuth {
+		return c.getTokensWithSRP(username, password)
+	}
+
 	log.Info("Getting access token")
 	params := &cognitoidentityprovider.InitiateAuthInput{
 		AuthFlow: aws.String("USER_PASSWORD_AUTH"),
@@ -53,52 +115,177 @@ func (c *cognitoHandler) GetTokens(username, password *string) (accessToken, ref
 	if err != nil {
 		return
 	}
-	log.Info(resp.GoString())
+	// The response carries the tokens or the challenge session, only the challenge name is logged
+	log.Infof("Authentication step completed, challenge: %v\n", aws.StringValue(resp.ChallengeName))
+	return tokensOrChallenge(resp.AuthenticationResult, resp.ChallengeName, resp.Session, resp.ChallengeParameters)
+}
+
+// getTokensWithSRP proves the password with SRP-6a, answering the PASSWORD_VERIFIER challenge
+func (c *cognitoHandler) getTokensWithSRP(username, password *string) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
 
-	// Ok
-	if resp.ChallengeName == nil {
-		accessToken = resp.AuthenticationResult.AccessToken
-		refreshToken = resp.AuthenticationResult.RefreshToken
+	srp, err := newSRPClient(*c.userPoolID)
+	if err != nil {
 		return
 	}
-	// NEW_PASSWORD_REQUIRED Challenge
-	if *resp.ChallengeName == "NEW_PASSWORD_REQUIRED" {
-		return c.responseToNewPassword(resp.Session, username, password)
+
+	log.Info("Getting access token with SRP")
+	params := &cognitoidentityprovider.InitiateAuthInput{
+		AuthFlow: aws.String("USER_SRP_AUTH"),
+		ClientId: c.appClientID,
+		AuthParameters: map[string]*string{
+			"USERNAME": username,
+			"SRP_A":    aws.String(srp.SRPA()),
+		},
 	}
-	// Others
-	err = errors.New("Unable to respond: " + *resp.ChallengeName)
-	return
+	req, resp := c.cognitoAPI.InitiateAuthRequest(params)
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	if resp.ChallengeName == nil || *resp.ChallengeName != "PASSWORD_VERIFIER" {
+		return tokensOrChallenge(resp.AuthenticationResult, resp.ChallengeName, resp.Session, resp.ChallengeParameters)
+	}
+
+	parameters := resp.ChallengeParameters
+	for _, name := range []string{"USER_ID_FOR_SRP", "SALT", "SRP_B", "SECRET_BLOCK"} {
+		if parameters[name] == nil {
+			err = ErrorInvalidSRPParameters
+			return
+		}
+	}
+	timestamp := srpTimestamp(time.Now())
+	signature, err := srp.passwordClaim(*parameters["USER_ID_FOR_SRP"], *password,
+		*parameters["SALT"], *parameters["SRP_B"], *parameters["SECRET_BLOCK"], timestamp)
+	if err != nil {
+		return
+	}
+	return c.respondToAuthChallenge(resp.ChallengeName, resp.Session, map[string]*string{
+		"USERNAME":                    parameters["USER_ID_FOR_SRP"],
+		"PASSWORD_CLAIM_SECRET_BLOCK": parameters["SECRET_BLOCK"],
+		"PASSWORD_CLAIM_SIGNATURE":    aws.String(signature),
+		"TIMESTAMP":                   aws.String(timestamp),
+	})
+}
+
+func (c *cognitoHandler) RespondToChallenge(request *entities.ChallengeRequest) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
+
+	if request == nil || request.ChallengeName == nil || request.Session == nil || request.Username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	responses := map[string]*string{
+		"USERNAME": request.Username,
+	}
+	switch *request.ChallengeName {
+	case "SMS_MFA":
+		responses["SMS_MFA_CODE"] = request.Code
+	case "SOFTWARE_TOKEN_MFA":
+		responses["SOFTWARE_TOKEN_MFA_CODE"] = request.Code
+	case "SELECT_MFA_TYPE":
+		if request.MFAType != nil && *request.MFAType != "SMS_MFA" && *request.MFAType != "SOFTWARE_TOKEN_MFA" {
+			err = fmt.Errorf("Unknown MFA type: %v", *request.MFAType)
+			return
+		}
+		responses["ANSWER"] = request.MFAType
+	case "NEW_PASSWORD_REQUIRED":
+		responses["NEW_PASSWORD"] = request.NewPassword
+		for name, value := range request.Attributes {
+			responses["userAttributes."+name] = aws.String(value)
+		}
+	case "CUSTOM_CHALLENGE":
+		responses["ANSWER"] = request.Answer
+	case "MFA_SETUP":
+		return c.respondToMFASetup(request)
+	default:
+		err = errors.New("Unable to respond: " + *request.ChallengeName)
+		return
+	}
+	for _, response := range responses {
+		if response == nil {
+			err = ErrorInvalidInputParameters
+			return
+		}
+	}
+
+	log.Infof("Responding to %v challenge\n", *request.ChallengeName)
+	return c.respondToAuthChallenge(request.ChallengeName, request.Session, responses)
+}
+
+// respondToMFASetup enrolls an authenticator app during login: without a code it returns the
+// secret to enroll (SECRET_CODE), with the code from the app it verifies it and completes the login
+func (c *cognitoHandler) respondToMFASetup(request *entities.ChallengeRequest) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
+	if request.Code == nil {
+		log.Info("Associating software token")
+		req, resp := c.cognitoAPI.AssociateSoftwareTokenRequest(&cognitoidentityprovider.AssociateSoftwareTokenInput{
+			Session: request.Session,
+		})
+		if err = req.Send(); err != nil {
+			return
+		}
+		challenge = &entities.Challenge{
+			Name:    aws.String("MFA_SETUP"),
+			Session: resp.Session,
+			Parameters: map[string]*string{
+				"SECRET_CODE": resp.SecretCode,
+			},
+		}
+		return
+	}
+
+	log.Info("Verifying software token")
+	req, resp := c.cognitoAPI.VerifySoftwareTokenRequest(&cognitoidentityprovider.VerifySoftwareTokenInput{
+		Session:  request.Session,
+		UserCode: request.Code,
+	})
+	if err = req.Send(); err != nil {
+		return
+	}
+	if resp.Status == nil || *resp.Status != cognitoidentityprovider.VerifySoftwareTokenResponseTypeSuccess {
+		err = errors.New("Unable to verify software token")
+		return
+	}
+	return c.respondToAuthChallenge(aws.String("MFA_SETUP"), resp.Session, map[string]*string{
+		"USERNAME": request.Username,
+	})
 }
 
-func (c *cognitoHandler) responseToNewPassword(session, username, password *string) (accessToken, refreshToken *string, err error) {
-	log.Infoln("New password required. Responding chanllenge with old password")
+func (c *cognitoHandler) respondToAuthChallenge(name, session *string, responses map[string]*string) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
 	params := &cognitoidentityprovider.RespondToAuthChallengeInput{
-		Session:       session,
-		ChallengeName: aws.String("NEW_PASSWORD_REQUIRED"),
-		ClientId:      c.appClientID,
-		ChallengeResponses: map[string]*string{
-			"USERNAME":     username,
-			"NEW_PASSWORD": password,
-		},
+		Session:            session,
+		ChallengeName:      name,
+		ClientId:           c.appClientID,
+		ChallengeResponses: responses,
 	}
 	req, resp := c.cognitoAPI.RespondToAuthChallengeRequest(params)
 	err = req.Send()
 	if err != nil {
 		return
 	}
+	// The response carries the tokens or the challenge session, only the challenge name is logged
+	log.Infof("Authentication step completed, challenge: %v\n", aws.StringValue(resp.ChallengeName))
+	return tokensOrChallenge(resp.AuthenticationResult, resp.ChallengeName, resp.Session, resp.ChallengeParameters)
+}
 
-	if resp.AuthenticationResult == nil {
+// tokensOrChallenge maps the outcome of an authentication step: either the tokens or the next challenge
+func tokensOrChallenge(result *cognitoidentityprovider.AuthenticationResultType, name, session *string, parameters map[string]*string) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
+	if name != nil {
+		challenge = &entities.Challenge{
+			Name:       name,
+			Session:    session,
+			Parameters: parameters,
+		}
+		return
+	}
+	if result == nil {
 		err = errors.New("Unable to get AccessToken")
 		return
 	}
-
-	log.Info(resp.GoString())
-	accessToken = resp.AuthenticationResult.AccessToken
-	refreshToken = resp.AuthenticationResult.RefreshToken
+	tokens = tokensFromResult(result, nil)
 	return
 }
 
-func (c *cognitoHandler) RefreshAccessToken(token *string) (accessToken, refreshToken *string, err error) {
+func (c *cognitoHandler) RefreshAccessToken(token *string) (tokens *entities.Tokens, err error) {
 
 	if token == nil {
 		err = ErrorInvalidInputParameters
@@ -118,54 +305,853 @@ func (c *cognitoHandler) RefreshAccessToken(token *string) (accessToken, refresh
 	if err != nil {
 		return
 	}
-	log.Info(resp.GoString())
 	if resp.AuthenticationResult == nil {
 		err = errors.New("Unable to get AccessToken")
 		return
 	}
-	accessToken = resp.AuthenticationResult.AccessToken
-	refreshToken = token
+	tokens = tokensFromResult(resp.AuthenticationResult, token)
+	return
+}
+
+func (c *cognitoHandler) RevokeToken(refreshToken *string) (err error) {
+
+	if refreshToken == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Revoking refresh token")
+	req, _ := c.cognitoAPI.RevokeTokenRequest(&cognitoidentityprovider.RevokeTokenInput{
+		ClientId: c.appClientID,
+		Token:    refreshToken,
+	})
+	err = req.Send()
 	return
 }
 
-func (c *cognitoHandler) RegisterUser(username, password *string) (sub *string, err error) {
+func (c *cognitoHandler) GlobalSignOut(accessToken *string) (err error) {
+
+	if accessToken == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Signing out user")
+	req, _ := c.cognitoAPI.GlobalSignOutRequest(&cognitoidentityprovider.GlobalSignOutInput{
+		AccessToken: accessToken,
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) AdminGlobalSignOut(username *string) (err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Signing out user as administrator")
+	req, _ := c.cognitoAPI.AdminUserGlobalSignOutRequest(&cognitoidentityprovider.AdminUserGlobalSignOutInput{
+		UserPoolId: c.userPoolID,
+		Username:   username,
+	})
+	err = req.Send()
+	return
+}
+
+// AuthenticateClient compares the secret with the one of the app client, the clients without a secret are refused
+func (c *cognitoHandler) AuthenticateClient(clientID, clientSecret *string) (err error) {
+
+	if clientID == nil || clientSecret == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	secret, err := c.clientSecret(*clientID)
+	if err != nil {
+		return
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(*clientSecret)) != 1 {
+		err = &entities.OAuthError{Code: "invalid_client", Description: "Invalid client credentials"}
+	}
+	return
+}
+
+func (c *cognitoHandler) clientSecret(clientID string) (string, error) {
+	c.clientSecretsMu.Lock()
+	cached, ok := c.clientSecrets[clientID]
+	c.clientSecretsMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.secret, nil
+	}
+
+	log.Info("Describing app client")
+	req, resp := c.cognitoAPI.DescribeUserPoolClientRequest(&cognitoidentityprovider.DescribeUserPoolClientInput{
+		ClientId:   aws.String(clientID),
+		UserPoolId: c.userPoolID,
+	})
+	if err := req.Send(); err != nil {
+		return "", err
+	}
+	secret := ""
+	if resp.UserPoolClient != nil {
+		secret = aws.StringValue(resp.UserPoolClient.ClientSecret)
+	}
+
+	c.clientSecretsMu.Lock()
+	c.clientSecrets[clientID] = cachedClientSecret{secret: secret, expires: time.Now().Add(clientSecretTTL)}
+	c.clientSecretsMu.Unlock()
+	return secret, nil
+}
+
+func (c *cognitoHandler) GetClientCredentialsTokens(clientID, clientSecret, scope *string) (tokens *entities.Tokens, err error) {
+
+	if clientID == nil || clientSecret == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+	if c.oauth2 == nil {
+		err = &entities.OAuthError{Code: "unsupported_grant_type", Description: "client_credentials grant is not configured"}
+		return
+	}
+
+	log.Info("Getting client credentials token")
+	params := url.Values{"grant_type": {"client_credentials"}}
+	if scope != nil && *scope != "" {
+		params.Set("scope", *scope)
+	}
+	return c.oauth2.requestTokens(params, *clientID, *clientSecret)
+}
+
+func (c *cognitoHandler) AuthorizationURL(request *entities.AuthorizationRequest) (string, error) {
+	if request == nil || request.RedirectURI == "" || request.State == "" || request.CodeChallenge == "" {
+		return "", ErrorInvalidInputParameters
+	}
+	if c.authorizeURL == "" {
+		return "", &entities.OAuthError{Code: "unsupported_response_type", Description: "hosted UI login is not configured"}
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {*c.appClientID},
+		"redirect_uri":          {request.RedirectURI},
+		"state":                 {request.State},
+		"code_challenge":        {request.CodeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	if request.Nonce != "" {
+		query.Set("nonce", request.Nonce)
+	}
+	if request.Scope != "" {
+		query.Set("scope", request.Scope)
+	}
+	if request.IdentityProvider != "" {
+		query.Set("identity_provider", request.IdentityProvider)
+	}
+	return c.authorizeURL + "?" + query.Encode(), nil
+}
+
+func (c *cognitoHandler) ExchangeAuthorizationCode(code, redirectURI, codeVerifier *string) (tokens *entities.Tokens, err error) {
+
+	if code == nil || redirectURI == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+	if c.oauth2 == nil {
+		err = &entities.OAuthError{Code: "unsupported_grant_type", Description: "authorization_code grant is not configured"}
+		return
+	}
+
+	log.Info("Exchanging authorization code")
+	params := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {*code},
+		"redirect_uri": {*redirectURI},
+	}
+	if codeVerifier != nil {
+		params.Set("code_verifier", *codeVerifier)
+	}
+	return c.oauth2.requestTokens(params, *c.appClientID, "")
+}
+
+// tokensFromResult maps the Cognito authentication result, the refresh token is only returned on login
+// so refreshToken is used when the result does not carry one
+func tokensFromResult(result *cognitoidentityprovider.AuthenticationResultType, refreshToken *string) *entities.Tokens {
+	tokens := &entities.Tokens{
+		AccessToken:  result.AccessToken,
+		IDToken:      result.IdToken,
+		RefreshToken: result.RefreshToken,
+		TokenType:    result.TokenType,
+		ExpiresIn:    result.ExpiresIn,
+	}
+	if tokens.RefreshToken == nil {
+		tokens.RefreshToken = refreshToken
+	}
+	if tokens.TokenType == nil {
+		tokens.TokenType = aws.String("Bearer")
+	}
+	if tokens.AccessToken != nil {
+		tokens.Scope = scopeFromAccessToken(*tokens.AccessToken)
+	}
+	return tokens
+}
+
+// scopeFromAccessToken reads the scope claim of a token just issued by the user pool
+func scopeFromAccessToken(accessToken string) *string {
+	token, _, err := new(jwt.Parser).ParseUnverified(accessToken, jwt.MapClaims{})
+	if err != nil {
+		return nil
+	}
+	if scope, ok := token.Claims.(jwt.MapClaims)["scope"].(string); ok {
+		return aws.String(scope)
+	}
+	return nil
+}
+
+func (c *cognitoHandler) RegisterUser(request *entities.RegistrationRequest) (registration *entities.Registration, err error) {
+
+	if request == nil || request.Username == nil || request.Password == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
 	log.Info("Registering new user")
 	params := &cognitoidentityprovider.SignUpInput{
+		ClientId:       c.appClientID,
+		Password:       request.Password,
+		Username:       request.Username,
+		UserAttributes: contactAttributes(request.Email, request.PhoneNumber),
+	}
+	req, resp := c.cognitoAPI.SignUpRequest(params)
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	registration = &entities.Registration{
+		Sub:                 resp.UserSub,
+		UserConfirmed:       resp.UserConfirmed,
+		CodeDeliveryDetails: codeDeliveryDetails(resp.CodeDeliveryDetails),
+	}
+	return
+}
+
+// contactAttributes are the attributes codes and invitations can be sent to
+func contactAttributes(email, phoneNumber *string) []*cognitoidentityprovider.AttributeType {
+	attributes := []*cognitoidentityprovider.AttributeType{}
+	if email != nil {
+		attributes = append(attributes, &cognitoidentityprovider.AttributeType{Name: aws.String("email"), Value: email})
+	}
+	if phoneNumber != nil {
+		attributes = append(attributes, &cognitoidentityprovider.AttributeType{Name: aws.String("phone_number"), Value: phoneNumber})
+	}
+	return attributes
+}
+
+// attributeTypes are the attributes sorted by name
+func attributeTypes(attributes map[string]string) []*cognitoidentityprovider.AttributeType {
+	names := []string{}
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	types := []*cognitoidentityprovider.AttributeType{}
+	for _, name := range names {
+		types = append(types, &cognitoidentityprovider.AttributeType{Name: aws.String(name), Value: aws.String(attributes[name])})
+	}
+	return types
+}
+
+func codeDeliveryDetails(details *cognitoidentityprovider.CodeDeliveryDetailsType) *entities.CodeDeliveryDetails {
+	if details == nil {
+		return nil
+	}
+	return &entities.CodeDeliveryDetails{
+		Destination:    details.Destination,
+		DeliveryMedium: details.DeliveryMedium,
+		AttributeName:  details.AttributeName,
+	}
+}
+
+func (c *cognitoHandler) ConfirmSignUp(username, code *string) (err error) {
+
+	if username == nil || code == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Confirming sign up")
+	req, _ := c.cognitoAPI.ConfirmSignUpRequest(&cognitoidentityprovider.ConfirmSignUpInput{
+		ClientId:         c.appClientID,
+		Username:         username,
+		ConfirmationCode: code,
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) ResendConfirmationCode(username *string) (delivery *entities.CodeDeliveryDetails, err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Resending confirmation code")
+	req, resp := c.cognitoAPI.ResendConfirmationCodeRequest(&cognitoidentityprovider.ResendConfirmationCodeInput{
 		ClientId: c.appClientID,
-		Password: password,
 		Username: username,
+	})
+	err = req.Send()
+	if err != nil {
+		return
 	}
-	req, resp := c.cognitoAPI.SignUpRequest(params)
+	delivery = codeDeliveryDetails(resp.CodeDeliveryDetails)
+	return
+}
+
+func (c *cognitoHandler) CreateUser(request *entities.CreateUserRequest) (user *entities.UserModel, err error) {
+
+	if err = validateCreateUserRequest(request); err != nil {
+		return
+	}
+
+	log.Info("Creating user")
+	req, resp := c.cognitoAPI.AdminCreateUserRequest(&cognitoidentityprovider.AdminCreateUserInput{
+		UserPoolId:             c.userPoolID,
+		Username:               request.Username,
+		TemporaryPassword:      request.TemporaryPassword,
+		UserAttributes:         append(contactAttributes(request.Email, request.PhoneNumber), attributeTypes(request.Attributes)...),
+		MessageAction:          request.MessageAction,
+		DesiredDeliveryMediums: aws.StringSlice(request.DesiredDeliveryMediums),
+	})
 	err = req.Send()
 	if err != nil {
 		return
 	}
-	log.Info(resp.GoString())
-	sub = resp.UserSub
+	if resp.User == nil {
+		err = errors.New("Unable to get the created user")
+		return
+	}
+	model := userModel(resp.User)
+	user = &model
 	return
 }
 
-func (c *cognitoHandler) ListUsers() (users []entities.UserModel, err error) {
-	log.Info("Getting all users")
+func validateCreateUserRequest(request *entities.CreateUserRequest) error {
+	if request == nil || request.Username == nil {
+		return ErrorInvalidInputParameters
+	}
+	for name := range request.Attributes {
+		switch name {
+		case "sub":
+			return errors.New("sub cannot be set")
+		case "email", "phone_number":
+			return fmt.Errorf("%v must be set with its own field", name)
+		}
+	}
+	if request.MessageAction != nil && *request.MessageAction != cognitoidentityprovider.MessageActionTypeSuppress &&
+		*request.MessageAction != cognitoidentityprovider.MessageActionTypeResend {
+		return fmt.Errorf("Unknown message action: %v", *request.MessageAction)
+	}
+	for _, medium := range request.DesiredDeliveryMediums {
+		if medium != cognitoidentityprovider.DeliveryMediumTypeEmail && medium != cognitoidentityprovider.DeliveryMediumTypeSms {
+			return fmt.Errorf("Unknown delivery medium: %v", medium)
+		}
+		if medium == cognitoidentityprovider.DeliveryMediumTypeEmail && request.Email == nil {
+			return errors.New("email is required to deliver the invitation by EMAIL")
+		}
+	}
+	return nil
+}
+
+func (c *cognitoHandler) ListUsers(request *entities.ListUsersRequest) (page *entities.UserPage, err error) {
+
+	if request == nil {
+		request = &entities.ListUsersRequest{}
+	}
+	limit, err := pageLimit(request.Limit)
+	if err != nil {
+		return
+	}
+	paginationToken, err := decodeCursor(request.Cursor)
+	if err != nil {
+		return
+	}
 	params := &cognitoidentityprovider.ListUsersInput{
-		UserPoolId: c.userPoolID,
+		UserPoolId:      c.userPoolID,
+		Limit:           aws.Int64(limit),
+		PaginationToken: paginationToken,
+	}
+	if request.Filter != nil && *request.Filter != "" {
+		// Invalid filters are reported before reaching Cognito
+		var filter *userFilter
+		if filter, err = parseUserFilter(*request.Filter); err != nil {
+			return
+		}
+		params.Filter = aws.String(filter.String())
+	}
+	if len(request.Attributes) > 0 {
+		params.AttributesToGet = aws.StringSlice(request.Attributes)
 	}
 
+	log.Info("Getting users")
 	req, resp := c.cognitoAPI.ListUsersRequest(params)
 	err = req.Send()
 	if err != nil {
 		return
 	}
-	log.Info(resp.GoString())
+	log.Infof("Got %v users, more pages: %v\n", len(resp.Users), resp.PaginationToken != nil)
+
+	page = &entities.UserPage{
+		Users:      []entities.UserModel{},
+		NextCursor: encodeCursor(resp.PaginationToken),
+	}
+	for _, user := range resp.Users {
+		model := userModel(user)
+		if request.IncludeGroups {
+			if model.Groups, err = c.UserGroups(user.Username); err != nil {
+				return nil, err
+			}
+		}
+		page.Users = append(page.Users, model)
+	}
+	return
+}
+
+func (c *cognitoHandler) GetUser(username *string) (user *entities.UserModel, err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Getting user")
+	req, resp := c.cognitoAPI.AdminGetUserRequest(&cognitoidentityprovider.AdminGetUserInput{
+		UserPoolId: c.userPoolID,
+		Username:   username,
+	})
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	model := userModel(&cognitoidentityprovider.UserType{
+		Username:             resp.Username,
+		UserStatus:           resp.UserStatus,
+		Enabled:              resp.Enabled,
+		UserCreateDate:       resp.UserCreateDate,
+		UserLastModifiedDate: resp.UserLastModifiedDate,
+		Attributes:           resp.UserAttributes,
+		MFAOptions:           resp.MFAOptions,
+	})
+	user = &model
+	return
+}
+
+func (c *cognitoHandler) UpdateUserAttributes(username *string, attributes map[string]string) (err error) {
+
+	if username == nil || len(attributes) == 0 {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Updating user attributes")
+	req, _ := c.cognitoAPI.AdminUpdateUserAttributesRequest(&cognitoidentityprovider.AdminUpdateUserAttributesInput{
+		UserPoolId:     c.userPoolID,
+		Username:       username,
+		UserAttributes: attributeTypes(attributes),
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) DeleteUserAttributes(username *string, names []string) (err error) {
+
+	if username == nil || len(names) == 0 {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Deleting user attributes")
+	req, _ := c.cognitoAPI.AdminDeleteUserAttributesRequest(&cognitoidentityprovider.AdminDeleteUserAttributesInput{
+		UserPoolId:         c.userPoolID,
+		Username:           username,
+		UserAttributeNames: aws.StringSlice(names),
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) DeleteUser(username *string) (err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Deleting user")
+	req, _ := c.cognitoAPI.AdminDeleteUserRequest(&cognitoidentityprovider.AdminDeleteUserInput{
+		UserPoolId: c.userPoolID,
+		Username:   username,
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) EnableUser(username *string) (err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Enabling user")
+	req, _ := c.cognitoAPI.AdminEnableUserRequest(&cognitoidentityprovider.AdminEnableUserInput{
+		UserPoolId: c.userPoolID,
+		Username:   username,
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) DisableUser(username *string) (err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Disabling user")
+	req, _ := c.cognitoAPI.AdminDisableUserRequest(&cognitoidentityprovider.AdminDisableUserInput{
+		UserPoolId: c.userPoolID,
+		Username:   username,
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) ListGroups(request *entities.PageRequest) (page *entities.GroupPage, err error) {
+
+	limit, nextToken, err := pageParameters(request)
+	if err != nil {
+		return
+	}
+
+	log.Info("Getting groups")
+	req, resp := c.cognitoAPI.ListGroupsRequest(&cognitoidentityprovider.ListGroupsInput{
+		UserPoolId: c.userPoolID,
+		Limit:      aws.Int64(limit),
+		NextToken:  nextToken,
+	})
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	page = groupPage(resp.Groups, resp.NextToken)
+	return
+}
+
+func (c *cognitoHandler) CreateGroup(request *entities.CreateGroupRequest) (group *entities.Group, err error) {
+
+	if request == nil || request.Name == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Creating group")
+	req, resp := c.cognitoAPI.CreateGroupRequest(&cognitoidentityprovider.CreateGroupInput{
+		UserPoolId:  c.userPoolID,
+		GroupName:   request.Name,
+		Description: request.Description,
+		Precedence:  request.Precedence,
+	})
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	if resp.Group == nil {
+		err = errors.New("Unable to get the created group")
+		return
+	}
+	model := groupModel(resp.Group)
+	group = &model
+	return
+}
+
+func (c *cognitoHandler) DeleteGroup(name *string) (err error) {
+
+	if name == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Deleting group")
+	req, _ := c.cognitoAPI.DeleteGroupRequest(&cognitoidentityprovider.DeleteGroupInput{
+		UserPoolId: c.userPoolID,
+		GroupName:  name,
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) AddUserToGroup(username, group *string) (err error) {
+
+	if username == nil || group == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Adding user to group")
+	req, _ := c.cognitoAPI.AdminAddUserToGroupRequest(&cognitoidentityprovider.AdminAddUserToGroupInput{
+		UserPoolId: c.userPoolID,
+		Username:   username,
+		GroupName:  group,
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) RemoveUserFromGroup(username, group *string) (err error) {
+
+	if username == nil || group == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Removing user from group")
+	req, _ := c.cognitoAPI.AdminRemoveUserFromGroupRequest(&cognitoidentityprovider.AdminRemoveUserFromGroupInput{
+		UserPoolId: c.userPoolID,
+		Username:   username,
+		GroupName:  group,
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) ListGroupsForUser(username *string, request *entities.PageRequest) (page *entities.GroupPage, err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+	limit, nextToken, err := pageParameters(request)
+	if err != nil {
+		return
+	}
+
+	log.Info("Getting groups for user")
+	req, resp := c.cognitoAPI.AdminListGroupsForUserRequest(&cognitoidentityprovider.AdminListGroupsForUserInput{
+		UserPoolId: c.userPoolID,
+		Username:   username,
+		Limit:      aws.Int64(limit),
+		NextToken:  nextToken,
+	})
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	page = groupPage(resp.Groups, resp.NextToken)
+	return
+}
+
+func (c *cognitoHandler) ListUsersInGroup(group *string, request *entities.PageRequest) (page *entities.UserPage, err error) {
+
+	if group == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+	limit, nextToken, err := pageParameters(request)
+	if err != nil {
+		return
+	}
 
-	users = []entities.UserModel{}
+	log.Info("Getting users in group")
+	req, resp := c.cognitoAPI.ListUsersInGroupRequest(&cognitoidentityprovider.ListUsersInGroupInput{
+		UserPoolId: c.userPoolID,
+		GroupName:  group,
+		Limit:      aws.Int64(limit),
+		NextToken:  nextToken,
+	})
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	page = &entities.UserPage{
+		Users:      []entities.UserModel{},
+		NextCursor: encodeCursor(resp.NextToken),
+	}
 	for _, user := range resp.Users {
-		users = append(users, entities.UserModel{
-			Username: user.Username,
-			Status:   user.UserStatus,
-			Enabled:  user.Enabled,
-			Created:  user.UserCreateDate,
+		page.Users = append(page.Users, userModel(user))
+	}
+	return
+}
+
+// UserGroups retries the throttled pages, ListUsers looks up the groups of every user of its page
+func (c *cognitoHandler) UserGroups(username *string) (groups []string, err error) {
+
+	groups = []string{}
+	request := &entities.PageRequest{}
+	for {
+		var page *entities.GroupPage
+		err := retryThrottled(c.sleep, func() (err error) {
+			page, err = c.ListGroupsForUser(username, request)
+			return
 		})
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range page.Groups {
+			groups = append(groups, aws.StringValue(group.Name))
+		}
+		if page.NextCursor == nil {
+			return groups, nil
+		}
+		request.Cursor = page.NextCursor
+	}
+}
+
+func (c *cognitoHandler) AssociateSoftwareToken(accessToken *string) (secretCode *string, err error) {
+
+	if accessToken == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	// The response carries the shared secret, it is not logged
+	log.Info("Associating software token")
+	req, resp := c.cognitoAPI.AssociateSoftwareTokenRequest(&cognitoidentityprovider.AssociateSoftwareTokenInput{
+		AccessToken: accessToken,
+	})
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	if resp.SecretCode == nil {
+		err = errors.New("Unable to get SecretCode")
+		return
+	}
+	secretCode = resp.SecretCode
+	return
+}
+
+func (c *cognitoHandler) VerifySoftwareToken(accessToken, code, deviceName *string) (err error) {
+
+	if accessToken == nil || code == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Verifying software token")
+	req, resp := c.cognitoAPI.VerifySoftwareTokenRequest(&cognitoidentityprovider.VerifySoftwareTokenInput{
+		AccessToken:        accessToken,
+		UserCode:           code,
+		FriendlyDeviceName: deviceName,
+	})
+	err = req.Send()
+	if err != nil {
+		return
 	}
+	log.Infof("Software token verification: %v\n", aws.StringValue(resp.Status))
+	if resp.Status == nil || *resp.Status != cognitoidentityprovider.VerifySoftwareTokenResponseTypeSuccess {
+		err = errors.New("Unable to verify software token")
+	}
+	return
+}
+
+func (c *cognitoHandler) SetSoftwareTokenMFAPreference(accessToken *string, enabled, preferred bool) (err error) {
+
+	if accessToken == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Infof("Setting software token MFA preference, enabled: %v, preferred: %v\n", enabled, preferred)
+	req, _ := c.cognitoAPI.SetUserMFAPreferenceRequest(&cognitoidentityprovider.SetUserMFAPreferenceInput{
+		AccessToken: accessToken,
+		SoftwareTokenMfaSettings: &cognitoidentityprovider.SoftwareTokenMfaSettingsType{
+			Enabled:      aws.Bool(enabled),
+			PreferredMfa: aws.Bool(preferred),
+		},
+	})
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (c *cognitoHandler) GetMFASettings(accessToken *string) (settings *entities.MFASettings, err error) {
+
+	if accessToken == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Getting MFA settings")
+	req, resp := c.cognitoAPI.GetUserRequest(&cognitoidentityprovider.GetUserInput{
+		AccessToken: accessToken,
+	})
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	settings = &entities.MFASettings{
+		Enabled:   aws.StringValueSlice(resp.UserMFASettingList),
+		Preferred: resp.PreferredMfaSetting,
+	}
+	return
+}
+
+func (c *cognitoHandler) ChangePassword(accessToken, currentPassword, newPassword *string) (err error) {
+
+	if accessToken == nil || currentPassword == nil || newPassword == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Changing password")
+	req, _ := c.cognitoAPI.ChangePasswordRequest(&cognitoidentityprovider.ChangePasswordInput{
+		AccessToken:      accessToken,
+		PreviousPassword: currentPassword,
+		ProposedPassword: newPassword,
+	})
+	err = req.Send()
+	return
+}
+
+func (c *cognitoHandler) ForgotPassword(username *string) (err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Sending forgot password code")
+	req, _ := c.cognitoAPI.ForgotPasswordRequest(&cognitoidentityprovider.ForgotPasswordInput{
+		ClientId: c.appClientID,
+		Username: username,
+	})
+	err = req.Send()
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (c *cognitoHandler) ConfirmForgotPassword(username, code, newPassword *string) (err error) {
+
+	if username == nil || code == nil || newPassword == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Confirming forgot password")
+	req, _ := c.cognitoAPI.ConfirmForgotPasswordRequest(&cognitoidentityprovider.ConfirmForgotPasswordInput{
+		ClientId:         c.appClientID,
+		Username:         username,
+		ConfirmationCode: code,
+		Password:         newPassword,
+	})
+	err = req.Send()
 	return
 }
@@ -2,34 +2,213 @@ package services
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider/cognitoidentityprovideriface"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
 )
 
 // mocks
+
+// mockRequest is sent by the SDK without reaching AWS
+func mockRequest() *request.Request {
+	return &request.Request{HTTPRequest: &http.Request{URL: &url.URL{}}}
+}
+
 type mockedCognitoClient struct {
 	cognitoidentityprovideriface.CognitoIdentityProviderAPI
 	initiateAuthRequest           *request.Request
 	initiateAuthOutput            *cognitoidentityprovider.InitiateAuthOutput
+	initiateAuthInput             *cognitoidentityprovider.InitiateAuthInput
 	respondToAuthChallengeRequest *request.Request
 	respondToAuthChallengeOutput  *cognitoidentityprovider.RespondToAuthChallengeOutput
+	respondToAuthChallengeInput   *cognitoidentityprovider.RespondToAuthChallengeInput
+	associateSoftwareTokenRequest *request.Request
+	associateSoftwareTokenOutput  *cognitoidentityprovider.AssociateSoftwareTokenOutput
+	verifySoftwareTokenRequest    *request.Request
+	verifySoftwareTokenOutput     *cognitoidentityprovider.VerifySoftwareTokenOutput
+	setUserMFAPreferenceRequest   *request.Request
+	setUserMFAPreferenceInput     *cognitoidentityprovider.SetUserMFAPreferenceInput
+	getUserRequest                *request.Request
+	getUserOutput                 *cognitoidentityprovider.GetUserOutput
+	adminCreateUserRequest        *request.Request
+	adminCreateUserOutput         *cognitoidentityprovider.AdminCreateUserOutput
+	adminCreateUserInput          *cognitoidentityprovider.AdminCreateUserInput
+	signUpRequest                 *request.Request
+	signUpOutput                  *cognitoidentityprovider.SignUpOutput
+	signUpInput                   *cognitoidentityprovider.SignUpInput
+	confirmSignUpRequest          *request.Request
+	resendConfirmationRequest     *request.Request
+	resendConfirmationOutput      *cognitoidentityprovider.ResendConfirmationCodeOutput
+	changePasswordRequest         *request.Request
+	changePasswordInput           *cognitoidentityprovider.ChangePasswordInput
+	forgotPasswordRequest         *request.Request
+	confirmForgotPasswordRequest  *request.Request
+	confirmForgotPasswordInput    *cognitoidentityprovider.ConfirmForgotPasswordInput
 	listUsersRequest              *request.Request
 	listUsersRequestOutput        *cognitoidentityprovider.ListUsersOutput
+	listUsersInput                *cognitoidentityprovider.ListUsersInput
+	adminGetUserRequest           *request.Request
+	adminGetUserOutput            *cognitoidentityprovider.AdminGetUserOutput
+	adminUpdateAttributesRequest  *request.Request
+	adminUpdateAttributesInput    *cognitoidentityprovider.AdminUpdateUserAttributesInput
+	adminDeleteAttributesRequest  *request.Request
+	adminDeleteAttributesInput    *cognitoidentityprovider.AdminDeleteUserAttributesInput
+	adminDeleteUserRequest        *request.Request
+	adminEnableUserRequest        *request.Request
+	adminDisableUserRequest       *request.Request
+	listGroupsRequest             *request.Request
+	listGroupsOutput              *cognitoidentityprovider.ListGroupsOutput
+	listGroupsInput               *cognitoidentityprovider.ListGroupsInput
+	createGroupRequest            *request.Request
+	createGroupOutput             *cognitoidentityprovider.CreateGroupOutput
+	createGroupInput              *cognitoidentityprovider.CreateGroupInput
+	deleteGroupRequest            *request.Request
+	addUserToGroupRequest         *request.Request
+	addUserToGroupInput           *cognitoidentityprovider.AdminAddUserToGroupInput
+	removeUserFromGroupRequest    *request.Request
+	listGroupsForUserRequest      *request.Request
+	listGroupsForUserOutputs      []*cognitoidentityprovider.AdminListGroupsForUserOutput
+	listGroupsForUserInputs       []*cognitoidentityprovider.AdminListGroupsForUserInput
+	listGroupsForUserThrottles    int
+	listUsersInGroupRequest       *request.Request
+	listUsersInGroupOutput        *cognitoidentityprovider.ListUsersInGroupOutput
+	revokeTokenRequest            *request.Request
+	revokeTokenInput              *cognitoidentityprovider.RevokeTokenInput
+	globalSignOutRequest          *request.Request
+	adminGlobalSignOutRequest     *request.Request
+	adminGlobalSignOutInput       *cognitoidentityprovider.AdminUserGlobalSignOutInput
+	describeClientRequest         *request.Request
+	describeClientOutput          *cognitoidentityprovider.DescribeUserPoolClientOutput
+	describeClientCalls           int
 }
 
-func (m *mockedCognitoClient) InitiateAuthRequest(*cognitoidentityprovider.InitiateAuthInput) (*request.Request, *cognitoidentityprovider.InitiateAuthOutput) {
+func (m *mockedCognitoClient) InitiateAuthRequest(input *cognitoidentityprovider.InitiateAuthInput) (*request.Request, *cognitoidentityprovider.InitiateAuthOutput) {
+	m.initiateAuthInput = input
 	return m.initiateAuthRequest, m.initiateAuthOutput
 }
-func (m *mockedCognitoClient) RespondToAuthChallengeRequest(*cognitoidentityprovider.RespondToAuthChallengeInput) (*request.Request, *cognitoidentityprovider.RespondToAuthChallengeOutput) {
+func (m *mockedCognitoClient) RespondToAuthChallengeRequest(input *cognitoidentityprovider.RespondToAuthChallengeInput) (*request.Request, *cognitoidentityprovider.RespondToAuthChallengeOutput) {
+	m.respondToAuthChallengeInput = input
 	return m.respondToAuthChallengeRequest, m.respondToAuthChallengeOutput
 }
-func (m *mockedCognitoClient) ListUsersRequest(*cognitoidentityprovider.ListUsersInput) (*request.Request, *cognitoidentityprovider.ListUsersOutput) {
+func (m *mockedCognitoClient) AssociateSoftwareTokenRequest(*cognitoidentityprovider.AssociateSoftwareTokenInput) (*request.Request, *cognitoidentityprovider.AssociateSoftwareTokenOutput) {
+	return m.associateSoftwareTokenRequest, m.associateSoftwareTokenOutput
+}
+func (m *mockedCognitoClient) SetUserMFAPreferenceRequest(input *cognitoidentityprovider.SetUserMFAPreferenceInput) (*request.Request, *cognitoidentityprovider.SetUserMFAPreferenceOutput) {
+	m.setUserMFAPreferenceInput = input
+	return m.setUserMFAPreferenceRequest, &cognitoidentityprovider.SetUserMFAPreferenceOutput{}
+}
+func (m *mockedCognitoClient) AdminCreateUserRequest(input *cognitoidentityprovider.AdminCreateUserInput) (*request.Request, *cognitoidentityprovider.AdminCreateUserOutput) {
+	m.adminCreateUserInput = input
+	return m.adminCreateUserRequest, m.adminCreateUserOutput
+}
+func (m *mockedCognitoClient) SignUpRequest(input *cognitoidentityprovider.SignUpInput) (*request.Request, *cognitoidentityprovider.SignUpOutput) {
+	m.signUpInput = input
+	return m.signUpRequest, m.signUpOutput
+}
+func (m *mockedCognitoClient) ConfirmSignUpRequest(*cognitoidentityprovider.ConfirmSignUpInput) (*request.Request, *cognitoidentityprovider.ConfirmSignUpOutput) {
+	return m.confirmSignUpRequest, &cognitoidentityprovider.ConfirmSignUpOutput{}
+}
+func (m *mockedCognitoClient) ResendConfirmationCodeRequest(*cognitoidentityprovider.ResendConfirmationCodeInput) (*request.Request, *cognitoidentityprovider.ResendConfirmationCodeOutput) {
+	return m.resendConfirmationRequest, m.resendConfirmationOutput
+}
+func (m *mockedCognitoClient) ChangePasswordRequest(input *cognitoidentityprovider.ChangePasswordInput) (*request.Request, *cognitoidentityprovider.ChangePasswordOutput) {
+	m.changePasswordInput = input
+	return m.changePasswordRequest, &cognitoidentityprovider.ChangePasswordOutput{}
+}
+func (m *mockedCognitoClient) ForgotPasswordRequest(*cognitoidentityprovider.ForgotPasswordInput) (*request.Request, *cognitoidentityprovider.ForgotPasswordOutput) {
+	return m.forgotPasswordRequest, &cognitoidentityprovider.ForgotPasswordOutput{}
+}
+func (m *mockedCognitoClient) ConfirmForgotPasswordRequest(input *cognitoidentityprovider.ConfirmForgotPasswordInput) (*request.Request, *cognitoidentityprovider.ConfirmForgotPasswordOutput) {
+	m.confirmForgotPasswordInput = input
+	return m.confirmForgotPasswordRequest, &cognitoidentityprovider.ConfirmForgotPasswordOutput{}
+}
+func (m *mockedCognitoClient) GetUserRequest(*cognitoidentityprovider.GetUserInput) (*request.Request, *cognitoidentityprovider.GetUserOutput) {
+	return m.getUserRequest, m.getUserOutput
+}
+func (m *mockedCognitoClient) VerifySoftwareTokenRequest(*cognitoidentityprovider.VerifySoftwareTokenInput) (*request.Request, *cognitoidentityprovider.VerifySoftwareTokenOutput) {
+	return m.verifySoftwareTokenRequest, m.verifySoftwareTokenOutput
+}
+func (m *mockedCognitoClient) ListUsersRequest(input *cognitoidentityprovider.ListUsersInput) (*request.Request, *cognitoidentityprovider.ListUsersOutput) {
+	m.listUsersInput = input
 	return m.listUsersRequest, m.listUsersRequestOutput
 }
+func (m *mockedCognitoClient) ListGroupsRequest(input *cognitoidentityprovider.ListGroupsInput) (*request.Request, *cognitoidentityprovider.ListGroupsOutput) {
+	m.listGroupsInput = input
+	return m.listGroupsRequest, m.listGroupsOutput
+}
+func (m *mockedCognitoClient) CreateGroupRequest(input *cognitoidentityprovider.CreateGroupInput) (*request.Request, *cognitoidentityprovider.CreateGroupOutput) {
+	m.createGroupInput = input
+	return m.createGroupRequest, m.createGroupOutput
+}
+func (m *mockedCognitoClient) DeleteGroupRequest(*cognitoidentityprovider.DeleteGroupInput) (*request.Request, *cognitoidentityprovider.DeleteGroupOutput) {
+	return m.deleteGroupRequest, &cognitoidentityprovider.DeleteGroupOutput{}
+}
+func (m *mockedCognitoClient) AdminAddUserToGroupRequest(input *cognitoidentityprovider.AdminAddUserToGroupInput) (*request.Request, *cognitoidentityprovider.AdminAddUserToGroupOutput) {
+	m.addUserToGroupInput = input
+	return m.addUserToGroupRequest, &cognitoidentityprovider.AdminAddUserToGroupOutput{}
+}
+func (m *mockedCognitoClient) AdminRemoveUserFromGroupRequest(*cognitoidentityprovider.AdminRemoveUserFromGroupInput) (*request.Request, *cognitoidentityprovider.AdminRemoveUserFromGroupOutput) {
+	return m.removeUserFromGroupRequest, &cognitoidentityprovider.AdminRemoveUserFromGroupOutput{}
+}
+
+// AdminListGroupsForUserRequest returns the outputs in turn, one per page, after throttling the first calls
+func (m *mockedCognitoClient) AdminListGroupsForUserRequest(input *cognitoidentityprovider.AdminListGroupsForUserInput) (*request.Request, *cognitoidentityprovider.AdminListGroupsForUserOutput) {
+	if m.listGroupsForUserThrottles > 0 {
+		m.listGroupsForUserThrottles--
+		return &request.Request{Error: awserr.New("TooManyRequestsException", "Too many requests", nil)}, &cognitoidentityprovider.AdminListGroupsForUserOutput{}
+	}
+	output := m.listGroupsForUserOutputs[len(m.listGroupsForUserInputs)%len(m.listGroupsForUserOutputs)]
+	m.listGroupsForUserInputs = append(m.listGroupsForUserInputs, input)
+	return m.listGroupsForUserRequest, output
+}
+func (m *mockedCognitoClient) ListUsersInGroupRequest(*cognitoidentityprovider.ListUsersInGroupInput) (*request.Request, *cognitoidentityprovider.ListUsersInGroupOutput) {
+	return m.listUsersInGroupRequest, m.listUsersInGroupOutput
+}
+func (m *mockedCognitoClient) AdminGetUserRequest(*cognitoidentityprovider.AdminGetUserInput) (*request.Request, *cognitoidentityprovider.AdminGetUserOutput) {
+	return m.adminGetUserRequest, m.adminGetUserOutput
+}
+func (m *mockedCognitoClient) AdminUpdateUserAttributesRequest(input *cognitoidentityprovider.AdminUpdateUserAttributesInput) (*request.Request, *cognitoidentityprovider.AdminUpdateUserAttributesOutput) {
+	m.adminUpdateAttributesInput = input
+	return m.adminUpdateAttributesRequest, &cognitoidentityprovider.AdminUpdateUserAttributesOutput{}
+}
+func (m *mockedCognitoClient) AdminDeleteUserAttributesRequest(input *cognitoidentityprovider.AdminDeleteUserAttributesInput) (*request.Request, *cognitoidentityprovider.AdminDeleteUserAttributesOutput) {
+	m.adminDeleteAttributesInput = input
+	return m.adminDeleteAttributesRequest, &cognitoidentityprovider.AdminDeleteUserAttributesOutput{}
+}
+func (m *mockedCognitoClient) AdminDeleteUserRequest(*cognitoidentityprovider.AdminDeleteUserInput) (*request.Request, *cognitoidentityprovider.AdminDeleteUserOutput) {
+	return m.adminDeleteUserRequest, &cognitoidentityprovider.AdminDeleteUserOutput{}
+}
+func (m *mockedCognitoClient) AdminEnableUserRequest(*cognitoidentityprovider.AdminEnableUserInput) (*request.Request, *cognitoidentityprovider.AdminEnableUserOutput) {
+	return m.adminEnableUserRequest, &cognitoidentityprovider.AdminEnableUserOutput{}
+}
+func (m *mockedCognitoClient) AdminDisableUserRequest(*cognitoidentityprovider.AdminDisableUserInput) (*request.Request, *cognitoidentityprovider.AdminDisableUserOutput) {
+	return m.adminDisableUserRequest, &cognitoidentityprovider.AdminDisableUserOutput{}
+}
+func (m *mockedCognitoClient) RevokeTokenRequest(input *cognitoidentityprovider.RevokeTokenInput) (*request.Request, *cognitoidentityprovider.RevokeTokenOutput) {
+	m.revokeTokenInput = input
+	return m.revokeTokenRequest, &cognitoidentityprovider.RevokeTokenOutput{}
+}
+func (m *mockedCognitoClient) GlobalSignOutRequest(*cognitoidentityprovider.GlobalSignOutInput) (*request.Request, *cognitoidentityprovider.GlobalSignOutOutput) {
+	return m.globalSignOutRequest, &cognitoidentityprovider.GlobalSignOutOutput{}
+}
+func (m *mockedCognitoClient) AdminUserGlobalSignOutRequest(input *cognitoidentityprovider.AdminUserGlobalSignOutInput) (*request.Request, *cognitoidentityprovider.AdminUserGlobalSignOutOutput) {
+	m.adminGlobalSignOutInput = input
+	return m.adminGlobalSignOutRequest, &cognitoidentityprovider.AdminUserGlobalSignOutOutput{}
+}
+func (m *mockedCognitoClient) DescribeUserPoolClientRequest(*cognitoidentityprovider.DescribeUserPoolClientInput) (*request.Request, *cognitoidentityprovider.DescribeUserPoolClientOutput) {
+	m.describeClientCalls++
+	return m.describeClientRequest, m.describeClientOutput
+}
 
 func TestGetTokens(t *testing.T) {
 	authResult := &cognitoidentityprovider.AuthenticationResultType{
@@ -54,20 +233,20 @@ func TestGetTokens(t *testing.T) {
 			"client",
 			"userpool",
 			&mockedCognitoClient{
-				initiateAuthRequest: &request.Request{},
+				initiateAuthRequest: mockRequest(),
 				initiateAuthOutput: &cognitoidentityprovider.InitiateAuthOutput{
 					AuthenticationResult: authResult,
 				},
 			},
 		)
-		accessToken, refreshToken, err := cp.GetTokens(aws.String("username"), aws.String("password"))
+		tokens, _, err := cp.GetTokens(aws.String("username"), aws.String("password"))
 		if err != nil {
 			t.Errorf(err.Error())
 		}
-		if accessToken != nil && *accessToken != "ACCESS_TOKEN" {
+		if tokens.AccessToken != nil && *tokens.AccessToken != "ACCESS_TOKEN" {
 			t.Errorf("Access token does not match the expected value")
 		}
-		if refreshToken != nil && *refreshToken != "REFRESH_TOKEN" {
+		if tokens.RefreshToken != nil && *tokens.RefreshToken != "REFRESH_TOKEN" {
 			t.Errorf("The refresh token does not match the expected value")
 		}
 	})
@@ -86,66 +265,260 @@ func TestGetTokens(t *testing.T) {
 			t.Errorf("Expected error")
 		}
 	})
-	t.Run("Successfull GetTokens with NEW_PASSWORD_REQUIRED", func(t *testing.T) {
-		cp := NewCognitoHandler(
-			"client",
-			"userpool",
-			&mockedCognitoClient{
-				initiateAuthRequest: &request.Request{},
-				initiateAuthOutput: &cognitoidentityprovider.InitiateAuthOutput{
-					ChallengeName: aws.String("NEW_PASSWORD_REQUIRED"),
-				},
-				respondToAuthChallengeRequest: &request.Request{},
-				respondToAuthChallengeOutput: &cognitoidentityprovider.RespondToAuthChallengeOutput{
-					AuthenticationResult: authResult,
+	t.Run("Challenge GetTokens with NEW_PASSWORD_REQUIRED", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			initiateAuthRequest: mockRequest(),
+			initiateAuthOutput: &cognitoidentityprovider.InitiateAuthOutput{
+				ChallengeName: aws.String("NEW_PASSWORD_REQUIRED"),
+				Session:       aws.String("SESSION"),
+				ChallengeParameters: map[string]*string{
+					"requiredAttributes": aws.String("[]"),
 				},
 			},
-		)
-		accessToken, refreshToken, err := cp.GetTokens(aws.String("username"), aws.String("password"))
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		tokens, challenge, err := cp.GetTokens(aws.String("username"), aws.String("password"))
 		if err != nil {
 			t.Errorf(err.Error())
 		}
-		if accessToken != nil && *accessToken != "ACCESS_TOKEN" {
-			t.Errorf("Access token does not match the expected value")
+		if tokens != nil {
+			t.Errorf("No tokens expected before answering the challenge")
 		}
-		if refreshToken != nil && *refreshToken != "REFRESH_TOKEN" {
-			t.Errorf("The refresh token does not match the expected value")
+		if challenge == nil || *challenge.Name != "NEW_PASSWORD_REQUIRED" || *challenge.Session != "SESSION" {
+			t.Errorf("Challenge does not match the expected value")
 		}
-	})
-	t.Run("Fail GetTokens with NEW_PASSWORD_REQUIRED", func(t *testing.T) {
-		cp := NewCognitoHandler(
-			"client",
-			"userpool",
-			&mockedCognitoClient{
-				initiateAuthRequest: &request.Request{},
-				initiateAuthOutput: &cognitoidentityprovider.InitiateAuthOutput{
-					ChallengeName: aws.String("NEW_PASSWORD_REQUIRED"),
-				},
-				respondToAuthChallengeRequest: &request.Request{Error: expectedError},
-			},
-		)
-		_, _, err := cp.GetTokens(aws.String("username"), aws.String("password"))
-		if err != expectedError {
-			t.Errorf("Ëxpected error")
+		if mock.respondToAuthChallengeInput != nil {
+			t.Errorf("The challenge must not be answered with the old password")
 		}
 	})
-	t.Run("Fail GetTokens with OTHER challenge", func(t *testing.T) {
+	t.Run("Challenge GetTokens with OTHER challenge", func(t *testing.T) {
 		cp := NewCognitoHandler(
 			"client",
 			"userpool",
 			&mockedCognitoClient{
-				initiateAuthRequest: &request.Request{},
+				initiateAuthRequest: mockRequest(),
 				initiateAuthOutput: &cognitoidentityprovider.InitiateAuthOutput{
 					ChallengeName:        aws.String("OTHER"),
 					AuthenticationResult: authResult,
 				},
 			},
 		)
+		tokens, challenge, err := cp.GetTokens(aws.String("username"), aws.String("password"))
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if tokens != nil || challenge == nil || *challenge.Name != "OTHER" {
+			t.Errorf("Challenge expected")
+		}
+	})
+}
+
+func TestGetTokensWithSRP(t *testing.T) {
+	server := newTestSRPServer("us-west-2_userpool", "user-id", "password", "a1b2c3", "0123456789abcdef")
+	challenge := func() *cognitoidentityprovider.InitiateAuthOutput {
+		return &cognitoidentityprovider.InitiateAuthOutput{
+			ChallengeName: aws.String("PASSWORD_VERIFIER"),
+			ChallengeParameters: map[string]*string{
+				"USER_ID_FOR_SRP": aws.String("user-id"),
+				"SALT":            aws.String("a1b2c3"),
+				"SRP_B":           aws.String(server.SRPB()),
+				"SECRET_BLOCK":    aws.String("c2VjcmV0"),
+			},
+		}
+	}
+
+	t.Run("Successfull GetTokens with SRP", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			initiateAuthRequest:           mockRequest(),
+			initiateAuthOutput:            challenge(),
+			respondToAuthChallengeRequest: mockRequest(),
+			respondToAuthChallengeOutput: &cognitoidentityprovider.RespondToAuthChallengeOutput{
+				AuthenticationResult: &cognitoidentityprovider.AuthenticationResultType{AccessToken: aws.String("ACCESS_TOKEN")},
+			},
+		}
+		cp := NewCognitoHandler("client", "us-west-2_userpool", mock, WithSRPAuth())
+		tokens, _, err := cp.GetTokens(aws.String("username"), aws.String("password"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *tokens.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("Tokens expected")
+		}
+		if *mock.initiateAuthInput.AuthFlow != "USER_SRP_AUTH" || mock.initiateAuthInput.AuthParameters["PASSWORD"] != nil {
+			t.Errorf("The password must not be sent")
+		}
+		responses := mock.respondToAuthChallengeInput.ChallengeResponses
+		expected := server.signature(*mock.initiateAuthInput.AuthParameters["SRP_A"], "c2VjcmV0", *responses["TIMESTAMP"])
+		if *responses["PASSWORD_CLAIM_SIGNATURE"] != expected || *responses["USERNAME"] != "user-id" {
+			t.Errorf("Password claim does not match the expected value")
+		}
+	})
+	t.Run("Fail GetTokens with SRP missing parameters", func(t *testing.T) {
+		output := challenge()
+		delete(output.ChallengeParameters, "SRP_B")
+		cp := NewCognitoHandler("client", "us-west-2_userpool", &mockedCognitoClient{
+			initiateAuthRequest: mockRequest(),
+			initiateAuthOutput:  output,
+		}, WithSRPAuth())
 		_, _, err := cp.GetTokens(aws.String("username"), aws.String("password"))
+		if err != ErrorInvalidSRPParameters {
+			t.Errorf("Expected invalid SRP parameters")
+		}
+	})
+}
+
+func TestRespondToChallenge(t *testing.T) {
+	authResult := &cognitoidentityprovider.AuthenticationResultType{
+		AccessToken:  aws.String("ACCESS_TOKEN"),
+		RefreshToken: aws.String("REFRESH_TOKEN"),
+	}
+	expectedError := errors.New("Something went wrong")
+	answered := func() *mockedCognitoClient {
+		return &mockedCognitoClient{
+			respondToAuthChallengeRequest: mockRequest(),
+			respondToAuthChallengeOutput: &cognitoidentityprovider.RespondToAuthChallengeOutput{
+				AuthenticationResult: authResult,
+			},
+		}
+	}
+	challengeRequest := func(name string) *entities.ChallengeRequest {
+		return &entities.ChallengeRequest{
+			ChallengeName: aws.String(name),
+			Session:       aws.String("SESSION"),
+			Username:      aws.String("username"),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		request  *entities.ChallengeRequest
+		response string
+		value    string
+	}{
+		{"SMS_MFA", &entities.ChallengeRequest{Code: aws.String("123456")}, "SMS_MFA_CODE", "123456"},
+		{"SOFTWARE_TOKEN_MFA", &entities.ChallengeRequest{Code: aws.String("123456")}, "SOFTWARE_TOKEN_MFA_CODE", "123456"},
+		{"SELECT_MFA_TYPE", &entities.ChallengeRequest{MFAType: aws.String("SOFTWARE_TOKEN_MFA")}, "ANSWER", "SOFTWARE_TOKEN_MFA"},
+		{"NEW_PASSWORD_REQUIRED", &entities.ChallengeRequest{NewPassword: aws.String("new password")}, "NEW_PASSWORD", "new password"},
+		{"CUSTOM_CHALLENGE", &entities.ChallengeRequest{Answer: aws.String("42")}, "ANSWER", "42"},
+	}
+	for _, test := range tests {
+		t.Run("Successfull RespondToChallenge "+test.name, func(t *testing.T) {
+			mock := answered()
+			cp := NewCognitoHandler("client", "userpool", mock)
+			request := challengeRequest(test.name)
+			request.Code, request.MFAType, request.NewPassword, request.Answer = test.request.Code, test.request.MFAType, test.request.NewPassword, test.request.Answer
+			tokens, challenge, err := cp.RespondToChallenge(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if challenge != nil || *tokens.AccessToken != "ACCESS_TOKEN" {
+				t.Errorf("Tokens expected")
+			}
+			input := mock.respondToAuthChallengeInput
+			if *input.ChallengeName != test.name || *input.Session != "SESSION" || *input.ChallengeResponses["USERNAME"] != "username" {
+				t.Errorf("Challenge input does not match the expected value")
+			}
+			if *input.ChallengeResponses[test.response] != test.value {
+				t.Errorf("%v does not match the expected value", test.response)
+			}
+		})
+		t.Run("Missing answer on RespondToChallenge "+test.name, func(t *testing.T) {
+			cp := NewCognitoHandler("client", "userpool", answered())
+			_, _, err := cp.RespondToChallenge(challengeRequest(test.name))
+			if err != ErrorInvalidInputParameters {
+				t.Errorf("Expected error when missing answer")
+			}
+		})
+	}
+	t.Run("Successfull RespondToChallenge NEW_PASSWORD_REQUIRED with attributes", func(t *testing.T) {
+		mock := answered()
+		cp := NewCognitoHandler("client", "userpool", mock)
+		request := challengeRequest("NEW_PASSWORD_REQUIRED")
+		request.NewPassword = aws.String("new password")
+		request.Attributes = map[string]string{"email": "user@example.com"}
+		if _, _, err := cp.RespondToChallenge(request); err != nil {
+			t.Fatal(err)
+		}
+		if *mock.respondToAuthChallengeInput.ChallengeResponses["userAttributes.email"] != "user@example.com" {
+			t.Errorf("Required attribute expected")
+		}
+	})
+	t.Run("Next challenge on RespondToChallenge", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			respondToAuthChallengeRequest: mockRequest(),
+			respondToAuthChallengeOutput: &cognitoidentityprovider.RespondToAuthChallengeOutput{
+				ChallengeName: aws.String("SOFTWARE_TOKEN_MFA"),
+				Session:       aws.String("NEXT_SESSION"),
+			},
+		})
+		request := challengeRequest("NEW_PASSWORD_REQUIRED")
+		request.NewPassword = aws.String("new password")
+		tokens, challenge, err := cp.RespondToChallenge(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens != nil || *challenge.Name != "SOFTWARE_TOKEN_MFA" || *challenge.Session != "NEXT_SESSION" {
+			t.Errorf("Next challenge expected")
+		}
+	})
+	t.Run("Successfull RespondToChallenge MFA_SETUP", func(t *testing.T) {
+		mock := answered()
+		mock.associateSoftwareTokenRequest = mockRequest()
+		mock.associateSoftwareTokenOutput = &cognitoidentityprovider.AssociateSoftwareTokenOutput{
+			SecretCode: aws.String("SECRET"),
+			Session:    aws.String("ASSOCIATED_SESSION"),
+		}
+		mock.verifySoftwareTokenRequest = mockRequest()
+		mock.verifySoftwareTokenOutput = &cognitoidentityprovider.VerifySoftwareTokenOutput{
+			Status:  aws.String("SUCCESS"),
+			Session: aws.String("VERIFIED_SESSION"),
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+
+		_, challenge, err := cp.RespondToChallenge(challengeRequest("MFA_SETUP"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *challenge.Name != "MFA_SETUP" || *challenge.Session != "ASSOCIATED_SESSION" || *challenge.Parameters["SECRET_CODE"] != "SECRET" {
+			t.Errorf("Secret to enroll expected")
+		}
+
+		request := challengeRequest("MFA_SETUP")
+		request.Session = challenge.Session
+		request.Code = aws.String("123456")
+		tokens, _, err := cp.RespondToChallenge(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *tokens.AccessToken != "ACCESS_TOKEN" || *mock.respondToAuthChallengeInput.Session != "VERIFIED_SESSION" {
+			t.Errorf("Tokens expected after verifying the software token")
+		}
+	})
+	t.Run("Fail RespondToChallenge", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			respondToAuthChallengeRequest: &request.Request{Error: expectedError},
+		})
+		request := challengeRequest("SMS_MFA")
+		request.Code = aws.String("123456")
+		_, _, err := cp.RespondToChallenge(request)
+		if err != expectedError {
+			t.Errorf("Expected error")
+		}
+	})
+	t.Run("Fail RespondToChallenge with unknown challenge", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", answered())
+		_, _, err := cp.RespondToChallenge(challengeRequest("OTHER"))
 		if err == nil {
 			t.Errorf("Error expected")
 		}
 	})
+	t.Run("Missing parameters on RespondToChallenge", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", answered())
+		_, _, err := cp.RespondToChallenge(&entities.ChallengeRequest{})
+		if err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+	})
 }
 
 func TestRefreshAccessToken(t *testing.T) {
@@ -159,7 +532,7 @@ func TestRefreshAccessToken(t *testing.T) {
 			"userpool",
 			&mockedCognitoClient{},
 		)
-		_, _, err := cp.RefreshAccessToken(nil)
+		_, err := cp.RefreshAccessToken(nil)
 		if err != ErrorInvalidInputParameters {
 			t.Errorf("Expected error when nil parameters")
 		}
@@ -169,20 +542,20 @@ func TestRefreshAccessToken(t *testing.T) {
 			"client",
 			"userpool",
 			&mockedCognitoClient{
-				initiateAuthRequest: &request.Request{},
+				initiateAuthRequest: mockRequest(),
 				initiateAuthOutput: &cognitoidentityprovider.InitiateAuthOutput{
 					AuthenticationResult: authResult,
 				},
 			},
 		)
-		accessToken, refreshToken, err := cp.RefreshAccessToken(aws.String("refresh_token"))
+		tokens, err := cp.RefreshAccessToken(aws.String("refresh_token"))
 		if err != nil {
 			t.Errorf(err.Error())
 		}
-		if accessToken != nil && *accessToken != "ACCESS_TOKEN" {
+		if tokens.AccessToken != nil && *tokens.AccessToken != "ACCESS_TOKEN" {
 			t.Errorf("Access token does not match the expected value")
 		}
-		if refreshToken != nil && *refreshToken != "refresh_token" {
+		if tokens.RefreshToken != nil && *tokens.RefreshToken != "refresh_token" {
 			t.Errorf("The refresh token does not match the expected value")
 		}
 	})
@@ -191,13 +564,13 @@ func TestRefreshAccessToken(t *testing.T) {
 			"client",
 			"userpool",
 			&mockedCognitoClient{
-				initiateAuthRequest: &request.Request{},
+				initiateAuthRequest: mockRequest(),
 				initiateAuthOutput: &cognitoidentityprovider.InitiateAuthOutput{
 					ChallengeName: aws.String("OTHER"),
 				},
 			},
 		)
-		_, _, err := cp.RefreshAccessToken(aws.String("refresh_token"))
+		_, err := cp.RefreshAccessToken(aws.String("refresh_token"))
 		if err == nil {
 			t.Errorf("Error expected")
 		}
@@ -210,7 +583,7 @@ func TestRefreshAccessToken(t *testing.T) {
 				initiateAuthRequest: &request.Request{Error: expectedError},
 			},
 		)
-		_, _, err := cp.RefreshAccessToken(aws.String("refresh_token"))
+		_, err := cp.RefreshAccessToken(aws.String("refresh_token"))
 
 		if err != expectedError {
 			t.Errorf("Expected error")
@@ -218,6 +591,39 @@ func TestRefreshAccessToken(t *testing.T) {
 	})
 }
 
+func TestSignOut(t *testing.T) {
+	expectedError := awserr.New("NotAuthorizedException", "Access Token has been revoked", nil)
+
+	t.Run("Successfull RevokeToken and AdminGlobalSignOut", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			revokeTokenRequest:        mockRequest(),
+			adminGlobalSignOutRequest: mockRequest(),
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		if err := cp.RevokeToken(aws.String("refresh")); err != nil {
+			t.Fatal(err)
+		}
+		if *mock.revokeTokenInput.ClientId != "client" || *mock.revokeTokenInput.Token != "refresh" {
+			t.Errorf("Input does not match the expected value")
+		}
+		if err := cp.AdminGlobalSignOut(aws.String("bob")); err != nil {
+			t.Fatal(err)
+		}
+		if *mock.adminGlobalSignOutInput.UserPoolId != "userpool" || *mock.adminGlobalSignOutInput.Username != "bob" {
+			t.Errorf("Input does not match the expected value")
+		}
+	})
+	t.Run("Fail GlobalSignOut", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{globalSignOutRequest: &request.Request{Error: expectedError}})
+		if err := cp.GlobalSignOut(aws.String("access")); err != expectedError {
+			t.Errorf("Expected error")
+		}
+		if err := cp.GlobalSignOut(nil); err != ErrorInvalidInputParameters {
+			t.Errorf("Access token is required")
+		}
+	})
+}
+
 func TestListUsers(t *testing.T) {
 	expectedError := errors.New("Something went wrong")
 	t.Run("Successfull ListUsers with three users", func(t *testing.T) {
@@ -225,7 +631,7 @@ func TestListUsers(t *testing.T) {
 			"client",
 			"userpool",
 			&mockedCognitoClient{
-				listUsersRequest: &request.Request{},
+				listUsersRequest: mockRequest(),
 				listUsersRequestOutput: &cognitoidentityprovider.ListUsersOutput{
 					Users: []*cognitoidentityprovider.UserType{
 						{Username: aws.String("username_1")},
@@ -235,11 +641,11 @@ func TestListUsers(t *testing.T) {
 				},
 			},
 		)
-		users, err := cp.ListUsers()
+		page, err := cp.ListUsers(nil)
 		if err != nil {
 			t.Errorf(err.Error())
 		}
-		if len(users) != 3 {
+		if len(page.Users) != 3 || page.NextCursor != nil {
 			t.Errorf("Three users expected")
 		}
 	})
@@ -248,17 +654,17 @@ func TestListUsers(t *testing.T) {
 			"client",
 			"userpool",
 			&mockedCognitoClient{
-				listUsersRequest: &request.Request{},
+				listUsersRequest: mockRequest(),
 				listUsersRequestOutput: &cognitoidentityprovider.ListUsersOutput{
 					Users: nil,
 				},
 			},
 		)
-		users, err := cp.ListUsers()
+		page, err := cp.ListUsers(nil)
 		if err != nil {
 			t.Errorf(err.Error())
 		}
-		if len(users) != 0 {
+		if len(page.Users) != 0 {
 			t.Errorf("Zero users expected")
 		}
 	})
@@ -270,10 +676,730 @@ func TestListUsers(t *testing.T) {
 				listUsersRequest: &request.Request{Error: expectedError},
 			},
 		)
-		_, err := cp.ListUsers()
+		_, err := cp.ListUsers(nil)
 
 		if err != expectedError {
 			t.Errorf("Expected error")
 		}
 	})
+	t.Run("Successfull ListUsers page", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			listUsersRequest: mockRequest(),
+			listUsersRequestOutput: &cognitoidentityprovider.ListUsersOutput{
+				Users: []*cognitoidentityprovider.UserType{{
+					Username: aws.String("username_1"),
+					Attributes: []*cognitoidentityprovider.AttributeType{
+						{Name: aws.String("email"), Value: aws.String("a@example.com")},
+						{Name: aws.String("email_verified"), Value: aws.String("true")},
+						{Name: aws.String("custom:team"), Value: aws.String("blue")},
+						{Name: aws.String("given_name"), Value: aws.String("Ann")},
+					},
+					MFAOptions: []*cognitoidentityprovider.MFAOptionType{{DeliveryMedium: aws.String("SMS"), AttributeName: aws.String("phone_number")}},
+				}},
+				PaginationToken: aws.String("NEXT_TOKEN"),
+			},
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		page, err := cp.ListUsers(&entities.ListUsersRequest{
+			Limit:      aws.Int64(1),
+			Filter:     aws.String(`email ^= "a"`),
+			Attributes: []string{"email"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := page.Users[0]
+		if *user.Email != "a@example.com" || !*user.EmailVerified || user.CustomAttributes["team"] != "blue" || len(user.CustomAttributes) != 1 ||
+			*user.MFAOptions[0].DeliveryMedium != "SMS" || page.NextCursor == nil {
+			t.Errorf("Page does not match the expected value")
+		}
+		input := mock.listUsersInput
+		if *input.Limit != 1 || *input.Filter != `email ^= "a"` || *input.AttributesToGet[0] != "email" || input.PaginationToken != nil {
+			t.Errorf("Input does not match the expected value")
+		}
+
+		if _, err = cp.ListUsers(&entities.ListUsersRequest{Cursor: page.NextCursor}); err != nil {
+			t.Fatal(err)
+		}
+		if *mock.listUsersInput.PaginationToken != "NEXT_TOKEN" || *mock.listUsersInput.Limit != 60 {
+			t.Errorf("The cursor must carry the pagination token")
+		}
+	})
+	t.Run("Fail ListUsers with invalid parameters", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{listUsersRequest: mockRequest()})
+		requests := []*entities.ListUsersRequest{
+			{Limit: aws.Int64(0)},
+			{Limit: aws.Int64(61)},
+			{Cursor: aws.String("not base64!")},
+			{Filter: aws.String(`email = a`)},
+			{Filter: aws.String(`custom:team = "a"`)},
+		}
+		for _, request := range requests {
+			if _, err := cp.ListUsers(request); err == nil {
+				t.Errorf("Error expected")
+			}
+		}
+	})
+}
+
+func TestParseUserFilter(t *testing.T) {
+	filter, err := parseUserFilter(`  cognito:user_status = "UN\"CONFIRMED"  `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.attribute != "cognito:user_status" || filter.prefix || filter.value != `UN"CONFIRMED` {
+		t.Errorf("Filter does not match the expected value")
+	}
+	if filter.String() != `cognito:user_status = "UN\"CONFIRMED"` {
+		t.Errorf("Expression does not match the expected value: %v", filter)
+	}
+	filter, err = parseUserFilter(`status = "UNCONFIRMED"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.attribute != "cognito:user_status" || filter.String() != `cognito:user_status = "UNCONFIRMED"` {
+		t.Errorf("status expected to filter on the user status: %v", filter)
+	}
+	filter, err = parseUserFilter(`email ^= "a"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.matches("alice@example.com") || filter.matches("bob@example.com") {
+		t.Errorf("Prefix filter expected")
+	}
+}
+
+func TestTokensFromResult(t *testing.T) {
+	accessToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"scope": "aws.cognito.signin.user.admin",
+	}).SignedString([]byte("secret"))
+
+	tokens := tokensFromResult(&cognitoidentityprovider.AuthenticationResultType{
+		AccessToken: aws.String(accessToken),
+		IdToken:     aws.String("ID_TOKEN"),
+		ExpiresIn:   aws.Int64(3600),
+	}, aws.String("REFRESH_TOKEN"))
+
+	if tokens.Scope == nil || *tokens.Scope != "aws.cognito.signin.user.admin" {
+		t.Errorf("Scope does not match the expected value")
+	}
+	if *tokens.TokenType != "Bearer" || *tokens.ExpiresIn != 3600 || *tokens.IDToken != "ID_TOKEN" {
+		t.Errorf("Tokens do not match the expected value")
+	}
+	if *tokens.RefreshToken != "REFRESH_TOKEN" {
+		t.Errorf("The refresh token does not match the expected value")
+	}
+}
+
+func TestGetClientCredentialsTokens(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"unsupported_grant_type"}`))
+			return
+		}
+		if clientID != "machine" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"ACCESS_TOKEN","expires_in":3600,"token_type":"Bearer","scope":"` + r.Form.Get("scope") + `"}`))
+	}))
+	defer ts.Close()
+
+	t.Run("Successfull GetClientCredentialsTokens", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{}, WithTokenURL(ts.URL))
+		tokens, err := cp.GetClientCredentialsTokens(aws.String("machine"), aws.String("secret"), aws.String("users/read"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *tokens.AccessToken != "ACCESS_TOKEN" || *tokens.ExpiresIn != 3600 || *tokens.Scope != "users/read" {
+			t.Errorf("Tokens do not match the expected value")
+		}
+		if tokens.RefreshToken != nil {
+			t.Errorf("No refresh token expected")
+		}
+	})
+	t.Run("Fail GetClientCredentialsTokens with wrong secret", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{}, WithTokenURL(ts.URL))
+		_, err := cp.GetClientCredentialsTokens(aws.String("machine"), aws.String("wrong"), nil)
+		if oerr, ok := err.(*entities.OAuthError); !ok || oerr.Code != "invalid_client" {
+			t.Errorf("Expected invalid_client error")
+		}
+	})
+	t.Run("Fail GetClientCredentialsTokens when not configured", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{})
+		_, err := cp.GetClientCredentialsTokens(aws.String("machine"), aws.String("secret"), nil)
+		if oerr, ok := err.(*entities.OAuthError); !ok || oerr.Code != "unsupported_grant_type" {
+			t.Errorf("Expected unsupported_grant_type error")
+		}
+	})
+	t.Run("Missing parameters on GetClientCredentialsTokens", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{}, WithTokenURL(ts.URL))
+		_, err := cp.GetClientCredentialsTokens(nil, nil, nil)
+		if err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+	})
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	t.Run("Successfull AuthenticateClient with cached secret", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			describeClientRequest: mockRequest(),
+			describeClientOutput: &cognitoidentityprovider.DescribeUserPoolClientOutput{
+				UserPoolClient: &cognitoidentityprovider.UserPoolClientType{ClientId: aws.String("machine"), ClientSecret: aws.String("secret")},
+			},
+		}
+		cp := NewCognitoHandler("client", "userpool", mock).(entities.ClientAuthenticator)
+		if err := cp.AuthenticateClient(aws.String("machine"), aws.String("secret")); err != nil {
+			t.Fatal(err)
+		}
+		err := cp.AuthenticateClient(aws.String("machine"), aws.String("wrong"))
+		if oerr, ok := err.(*entities.OAuthError); !ok || oerr.Code != "invalid_client" {
+			t.Errorf("invalid_client expected, got %v", err)
+		}
+		if mock.describeClientCalls != 1 {
+			t.Errorf("Secret expected to be cached, calls: %v", mock.describeClientCalls)
+		}
+	})
+	t.Run("Fail AuthenticateClient", func(t *testing.T) {
+		expectedError := awserr.New("ResourceNotFoundException", "User pool client does not exist.", nil)
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{describeClientRequest: &request.Request{Error: expectedError}}).(entities.ClientAuthenticator)
+		if err := cp.AuthenticateClient(aws.String("unknown"), aws.String("secret")); err != expectedError {
+			t.Errorf("Expected error")
+		}
+		cp = NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			describeClientRequest: mockRequest(),
+			describeClientOutput:  &cognitoidentityprovider.DescribeUserPoolClientOutput{UserPoolClient: &cognitoidentityprovider.UserPoolClientType{}},
+		}).(entities.ClientAuthenticator)
+		if err := cp.AuthenticateClient(aws.String("public"), aws.String("")); err == nil {
+			t.Errorf("Client without secret expected to fail")
+		}
+	})
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("client_id") != "client" ||
+			r.Form.Get("code") != "CODE" || r.Form.Get("code_verifier") != "VERIFIER" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"ACCESS_TOKEN","id_token":"ID_TOKEN","refresh_token":"REFRESH_TOKEN","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	defer ts.Close()
+	cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{},
+		WithTokenURL(ts.URL), WithAuthorizeURL("https://domain/oauth2/authorize")).(entities.AuthorizationCodeHandler)
+
+	t.Run("Successfull AuthorizationURL", func(t *testing.T) {
+		authorizationURL, err := cp.AuthorizationURL(&entities.AuthorizationRequest{
+			RedirectURI:      "https://app/api/oauth/callback",
+			State:            "STATE",
+			Nonce:            "NONCE",
+			CodeChallenge:    "CHALLENGE",
+			Scope:            "openid email",
+			IdentityProvider: "Google",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "https://domain/oauth2/authorize?client_id=client&code_challenge=CHALLENGE&code_challenge_method=S256" +
+			"&identity_provider=Google&nonce=NONCE&redirect_uri=https%3A%2F%2Fapp%2Fapi%2Foauth%2Fcallback" +
+			"&response_type=code&scope=openid+email&state=STATE"
+		if authorizationURL != expected {
+			t.Errorf("Authorization URL does not match the expected value: %v", authorizationURL)
+		}
+	})
+	t.Run("Fail AuthorizationURL without PKCE", func(t *testing.T) {
+		_, err := cp.AuthorizationURL(&entities.AuthorizationRequest{RedirectURI: "https://app", State: "STATE"})
+		if err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when missing parameters")
+		}
+	})
+	t.Run("Successfull ExchangeAuthorizationCode", func(t *testing.T) {
+		tokens, err := cp.ExchangeAuthorizationCode(aws.String("CODE"), aws.String("https://app"), aws.String("VERIFIER"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *tokens.AccessToken != "ACCESS_TOKEN" || *tokens.IDToken != "ID_TOKEN" || *tokens.RefreshToken != "REFRESH_TOKEN" {
+			t.Errorf("Tokens do not match the expected value")
+		}
+	})
+	t.Run("Fail ExchangeAuthorizationCode with wrong verifier", func(t *testing.T) {
+		_, err := cp.ExchangeAuthorizationCode(aws.String("CODE"), aws.String("https://app"), aws.String("OTHER"))
+		if oerr, ok := err.(*entities.OAuthError); !ok || oerr.Code != "invalid_grant" {
+			t.Errorf("Expected invalid_grant error")
+		}
+	})
+}
+
+func TestSoftwareTokenMFA(t *testing.T) {
+	expectedError := errors.New("Something went wrong")
+	accessToken := aws.String("ACCESS_TOKEN")
+
+	t.Run("Successfull AssociateSoftwareToken", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			associateSoftwareTokenRequest: mockRequest(),
+			associateSoftwareTokenOutput:  &cognitoidentityprovider.AssociateSoftwareTokenOutput{SecretCode: aws.String("SECRET")},
+		})
+		secretCode, err := cp.AssociateSoftwareToken(accessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *secretCode != "SECRET" {
+			t.Errorf("Secret code does not match the expected value")
+		}
+	})
+	t.Run("Fail AssociateSoftwareToken", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			associateSoftwareTokenRequest: &request.Request{Error: expectedError},
+		})
+		_, err := cp.AssociateSoftwareToken(accessToken)
+		if err != expectedError {
+			t.Errorf("Expected error")
+		}
+	})
+	t.Run("Successfull VerifySoftwareToken", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			verifySoftwareTokenRequest: mockRequest(),
+			verifySoftwareTokenOutput:  &cognitoidentityprovider.VerifySoftwareTokenOutput{Status: aws.String("SUCCESS")},
+		})
+		if err := cp.VerifySoftwareToken(accessToken, aws.String("123456"), nil); err != nil {
+			t.Errorf(err.Error())
+		}
+	})
+	t.Run("Fail VerifySoftwareToken with ERROR status", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			verifySoftwareTokenRequest: mockRequest(),
+			verifySoftwareTokenOutput:  &cognitoidentityprovider.VerifySoftwareTokenOutput{Status: aws.String("ERROR")},
+		})
+		if err := cp.VerifySoftwareToken(accessToken, aws.String("123456"), nil); err == nil {
+			t.Errorf("Error expected")
+		}
+	})
+	t.Run("Successfull SetSoftwareTokenMFAPreference", func(t *testing.T) {
+		mock := &mockedCognitoClient{setUserMFAPreferenceRequest: mockRequest()}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		if err := cp.SetSoftwareTokenMFAPreference(accessToken, true, false); err != nil {
+			t.Fatal(err)
+		}
+		settings := mock.setUserMFAPreferenceInput.SoftwareTokenMfaSettings
+		if !*settings.Enabled || *settings.PreferredMfa {
+			t.Errorf("MFA preference does not match the expected value")
+		}
+	})
+	t.Run("Successfull GetMFASettings", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			getUserRequest: mockRequest(),
+			getUserOutput: &cognitoidentityprovider.GetUserOutput{
+				UserMFASettingList:  aws.StringSlice([]string{"SOFTWARE_TOKEN_MFA"}),
+				PreferredMfaSetting: aws.String("SOFTWARE_TOKEN_MFA"),
+			},
+		})
+		settings, err := cp.GetMFASettings(accessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(settings.Enabled) != 1 || *settings.Preferred != "SOFTWARE_TOKEN_MFA" {
+			t.Errorf("MFA settings do not match the expected value")
+		}
+	})
+	t.Run("Missing parameters on MFA", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{})
+		if _, err := cp.AssociateSoftwareToken(nil); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+		if err := cp.VerifySoftwareToken(accessToken, nil, nil); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+		if err := cp.SetSoftwareTokenMFAPreference(nil, false, false); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+		if _, err := cp.GetMFASettings(nil); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+	})
+}
+
+func TestSignUp(t *testing.T) {
+	expectedError := errors.New("Something went wrong")
+	delivery := &cognitoidentityprovider.CodeDeliveryDetailsType{
+		AttributeName:  aws.String("email"),
+		DeliveryMedium: aws.String("EMAIL"),
+		Destination:    aws.String("b***@e***"),
+	}
+
+	t.Run("Successfull RegisterUser", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			signUpRequest: mockRequest(),
+			signUpOutput: &cognitoidentityprovider.SignUpOutput{
+				UserSub:             aws.String("SUB"),
+				UserConfirmed:       aws.Bool(false),
+				CodeDeliveryDetails: delivery,
+			},
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		registration, err := cp.RegisterUser(&entities.RegistrationRequest{
+			Username:    aws.String("bob"),
+			Password:    aws.String("password"),
+			Email:       aws.String("bob@example.com"),
+			PhoneNumber: aws.String("+61400000000"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *registration.Sub != "SUB" || *registration.UserConfirmed || *registration.CodeDeliveryDetails.DeliveryMedium != "EMAIL" {
+			t.Errorf("Registration does not match the expected value")
+		}
+		attributes := mock.signUpInput.UserAttributes
+		if len(attributes) != 2 || *attributes[0].Name != "email" || *attributes[1].Value != "+61400000000" {
+			t.Errorf("Contact attributes expected")
+		}
+	})
+	t.Run("Fail RegisterUser", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{signUpRequest: &request.Request{Error: expectedError}})
+		_, err := cp.RegisterUser(&entities.RegistrationRequest{Username: aws.String("bob"), Password: aws.String("password")})
+		if err != expectedError {
+			t.Errorf("Expected error")
+		}
+	})
+	t.Run("Successfull ConfirmSignUp", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{confirmSignUpRequest: mockRequest()})
+		if err := cp.ConfirmSignUp(aws.String("bob"), aws.String("123456")); err != nil {
+			t.Errorf(err.Error())
+		}
+	})
+	t.Run("Successfull ResendConfirmationCode", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			resendConfirmationRequest: mockRequest(),
+			resendConfirmationOutput:  &cognitoidentityprovider.ResendConfirmationCodeOutput{CodeDeliveryDetails: delivery},
+		})
+		details, err := cp.ResendConfirmationCode(aws.String("bob"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *details.Destination != "b***@e***" {
+			t.Errorf("Code delivery details do not match the expected value")
+		}
+	})
+	t.Run("Missing parameters on sign up", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{})
+		if _, err := cp.RegisterUser(&entities.RegistrationRequest{Username: aws.String("bob")}); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+		if err := cp.ConfirmSignUp(aws.String("bob"), nil); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+		if _, err := cp.ResendConfirmationCode(nil); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+	})
+}
+
+func TestCreateUser(t *testing.T) {
+	t.Run("Successfull CreateUser", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			adminCreateUserRequest: mockRequest(),
+			adminCreateUserOutput: &cognitoidentityprovider.AdminCreateUserOutput{
+				User: &cognitoidentityprovider.UserType{
+					Username:   aws.String("bob"),
+					UserStatus: aws.String("FORCE_CHANGE_PASSWORD"),
+					Enabled:    aws.Bool(true),
+				},
+			},
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		user, err := cp.CreateUser(&entities.CreateUserRequest{
+			Username:               aws.String("bob"),
+			TemporaryPassword:      aws.String("Temp1234!"),
+			Email:                  aws.String("bob@example.com"),
+			MessageAction:          aws.String("SUPPRESS"),
+			DesiredDeliveryMediums: []string{"EMAIL"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *user.Username != "bob" || *user.Status != "FORCE_CHANGE_PASSWORD" {
+			t.Errorf("User does not match the expected value")
+		}
+		input := mock.adminCreateUserInput
+		if *input.UserPoolId != "userpool" || *input.MessageAction != "SUPPRESS" || *input.DesiredDeliveryMediums[0] != "EMAIL" || *input.UserAttributes[0].Value != "bob@example.com" {
+			t.Errorf("Input does not match the expected value")
+		}
+	})
+	t.Run("Fail CreateUser with invalid options", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{adminCreateUserRequest: mockRequest()})
+		requests := []*entities.CreateUserRequest{
+			nil,
+			{Username: aws.String("bob"), MessageAction: aws.String("SEND")},
+			{Username: aws.String("bob"), DesiredDeliveryMediums: []string{"PIGEON"}},
+			{Username: aws.String("bob"), DesiredDeliveryMediums: []string{"EMAIL"}},
+		}
+		for _, request := range requests {
+			if _, err := cp.CreateUser(request); err == nil {
+				t.Errorf("Error expected")
+			}
+		}
+	})
+}
+
+func TestAdminUser(t *testing.T) {
+	expectedError := awserr.New("UserNotFoundException", "User does not exist.", nil)
+
+	t.Run("Successfull GetUser", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			adminGetUserRequest: mockRequest(),
+			adminGetUserOutput: &cognitoidentityprovider.AdminGetUserOutput{
+				Username:       aws.String("bob"),
+				UserStatus:     aws.String("CONFIRMED"),
+				Enabled:        aws.Bool(false),
+				UserAttributes: []*cognitoidentityprovider.AttributeType{{Name: aws.String("custom:team"), Value: aws.String("blue")}},
+			},
+		})
+		user, err := cp.GetUser(aws.String("bob"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *user.Username != "bob" || *user.Enabled || user.CustomAttributes["team"] != "blue" {
+			t.Errorf("User does not match the expected value")
+		}
+	})
+	t.Run("Fail GetUser", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{adminGetUserRequest: &request.Request{Error: expectedError}})
+		if _, err := cp.GetUser(aws.String("bob")); err != expectedError {
+			t.Errorf("Expected error")
+		}
+	})
+	t.Run("Successfull UpdateUserAttributes and DeleteUserAttributes", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			adminUpdateAttributesRequest: mockRequest(),
+			adminDeleteAttributesRequest: mockRequest(),
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		if err := cp.UpdateUserAttributes(aws.String("bob"), map[string]string{"name": "Bob"}); err != nil {
+			t.Fatal(err)
+		}
+		input := mock.adminUpdateAttributesInput
+		if *input.UserPoolId != "userpool" || *input.Username != "bob" || *input.UserAttributes[0].Name != "name" || *input.UserAttributes[0].Value != "Bob" {
+			t.Errorf("Input does not match the expected value")
+		}
+		if err := cp.DeleteUserAttributes(aws.String("bob"), []string{"custom:team"}); err != nil {
+			t.Fatal(err)
+		}
+		if *mock.adminDeleteAttributesInput.UserAttributeNames[0] != "custom:team" {
+			t.Errorf("Input does not match the expected value")
+		}
+		if err := cp.UpdateUserAttributes(aws.String("bob"), nil); err != ErrorInvalidInputParameters {
+			t.Errorf("Attributes are required")
+		}
+	})
+	t.Run("DeleteUser, EnableUser and DisableUser", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			adminDeleteUserRequest:  mockRequest(),
+			adminEnableUserRequest:  mockRequest(),
+			adminDisableUserRequest: &request.Request{Error: expectedError},
+		})
+		if err := cp.DeleteUser(aws.String("bob")); err != nil {
+			t.Errorf(err.Error())
+		}
+		if err := cp.EnableUser(aws.String("bob")); err != nil {
+			t.Errorf(err.Error())
+		}
+		if err := cp.DisableUser(aws.String("bob")); err != expectedError {
+			t.Errorf("Expected error")
+		}
+	})
+}
+
+func TestGroups(t *testing.T) {
+	expectedError := awserr.New("ResourceNotFoundException", "Group not found.", nil)
+
+	t.Run("Successfull ListGroups", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			listGroupsRequest: mockRequest(),
+			listGroupsOutput: &cognitoidentityprovider.ListGroupsOutput{
+				Groups:    []*cognitoidentityprovider.GroupType{{GroupName: aws.String("admin"), Precedence: aws.Int64(1)}},
+				NextToken: aws.String("NEXT_TOKEN"),
+			},
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		page, err := cp.ListGroups(&entities.PageRequest{Limit: aws.Int64(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *page.Groups[0].Name != "admin" || *page.Groups[0].Precedence != 1 || page.NextCursor == nil {
+			t.Errorf("Page does not match the expected value")
+		}
+		if _, err = cp.ListGroups(&entities.PageRequest{Cursor: page.NextCursor}); err != nil {
+			t.Fatal(err)
+		}
+		if *mock.listGroupsInput.NextToken != "NEXT_TOKEN" || *mock.listGroupsInput.Limit != 60 {
+			t.Errorf("The cursor must carry the next token")
+		}
+	})
+	t.Run("Successfull CreateGroup", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			createGroupRequest: mockRequest(),
+			createGroupOutput:  &cognitoidentityprovider.CreateGroupOutput{Group: &cognitoidentityprovider.GroupType{GroupName: aws.String("reader")}},
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		group, err := cp.CreateGroup(&entities.CreateGroupRequest{Name: aws.String("reader"), Description: aws.String("Read only")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *group.Name != "reader" || *mock.createGroupInput.Description != "Read only" || *mock.createGroupInput.UserPoolId != "userpool" {
+			t.Errorf("Group does not match the expected value")
+		}
+	})
+	t.Run("Add, remove and delete", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			addUserToGroupRequest:      mockRequest(),
+			removeUserFromGroupRequest: mockRequest(),
+			deleteGroupRequest:         &request.Request{Error: expectedError},
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		if err := cp.AddUserToGroup(aws.String("bob"), aws.String("reader")); err != nil {
+			t.Fatal(err)
+		}
+		if *mock.addUserToGroupInput.Username != "bob" || *mock.addUserToGroupInput.GroupName != "reader" {
+			t.Errorf("Input does not match the expected value")
+		}
+		if err := cp.RemoveUserFromGroup(aws.String("bob"), aws.String("reader")); err != nil {
+			t.Errorf(err.Error())
+		}
+		if err := cp.DeleteGroup(aws.String("reader")); err != expectedError {
+			t.Errorf("Expected error")
+		}
+		if err := cp.AddUserToGroup(nil, aws.String("reader")); err != ErrorInvalidInputParameters {
+			t.Errorf("Username is required")
+		}
+	})
+	t.Run("Successfull ListUsers with groups", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			listUsersRequest: mockRequest(),
+			listUsersRequestOutput: &cognitoidentityprovider.ListUsersOutput{
+				Users: []*cognitoidentityprovider.UserType{{Username: aws.String("bob")}},
+			},
+			listGroupsForUserRequest: mockRequest(),
+			listGroupsForUserOutputs: []*cognitoidentityprovider.AdminListGroupsForUserOutput{
+				{Groups: []*cognitoidentityprovider.GroupType{{GroupName: aws.String("admin")}}, NextToken: aws.String("NEXT_TOKEN")},
+				{Groups: []*cognitoidentityprovider.GroupType{{GroupName: aws.String("reader")}}},
+			},
+			listGroupsForUserThrottles: 2,
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		sleeps := []time.Duration{}
+		cp.(*cognitoHandler).sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+		page, err := cp.ListUsers(&entities.ListUsersRequest{IncludeGroups: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups := page.Users[0].Groups
+		if len(groups) != 2 || groups[0] != "admin" || groups[1] != "reader" {
+			t.Errorf("Every page of groups expected: %v", groups)
+		}
+		if len(mock.listGroupsForUserInputs) != 2 || *mock.listGroupsForUserInputs[1].NextToken != "NEXT_TOKEN" {
+			t.Errorf("Input does not match the expected value")
+		}
+		if len(sleeps) != 2 || sleeps[1] != 2*throttleBackoff {
+			t.Errorf("Throttled lookups expected to be retried with backoff: %v", sleeps)
+		}
+	})
+	t.Run("Fail ListUsers with groups when throttled", func(t *testing.T) {
+		mock := &mockedCognitoClient{
+			listUsersRequest: mockRequest(),
+			listUsersRequestOutput: &cognitoidentityprovider.ListUsersOutput{
+				Users: []*cognitoidentityprovider.UserType{{Username: aws.String("bob")}},
+			},
+			listGroupsForUserThrottles: throttleMaxAttempts,
+		}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		cp.(*cognitoHandler).sleep = func(time.Duration) {}
+		if _, err := cp.ListUsers(&entities.ListUsersRequest{IncludeGroups: true}); err == nil {
+			t.Errorf("Error expected after %v attempts", throttleMaxAttempts)
+		}
+	})
+	t.Run("Successfull ListUsersInGroup", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{
+			listUsersInGroupRequest: mockRequest(),
+			listUsersInGroupOutput: &cognitoidentityprovider.ListUsersInGroupOutput{
+				Users: []*cognitoidentityprovider.UserType{{Username: aws.String("bob")}},
+			},
+		})
+		page, err := cp.ListUsersInGroup(aws.String("reader"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Users) != 1 || *page.Users[0].Username != "bob" || page.NextCursor != nil {
+			t.Errorf("Page does not match the expected value")
+		}
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Run("Successfull ChangePassword", func(t *testing.T) {
+		mock := &mockedCognitoClient{changePasswordRequest: mockRequest()}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		if err := cp.ChangePassword(aws.String("ACCESS_TOKEN"), aws.String("old password"), aws.String("new password")); err != nil {
+			t.Fatal(err)
+		}
+		input := mock.changePasswordInput
+		if *input.AccessToken != "ACCESS_TOKEN" || *input.PreviousPassword != "old password" || *input.ProposedPassword != "new password" {
+			t.Errorf("Input does not match the expected value")
+		}
+	})
+	t.Run("Fail ChangePassword", func(t *testing.T) {
+		expectedError := awserr.New("NotAuthorizedException", "Incorrect username or password.", nil)
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{changePasswordRequest: &request.Request{Error: expectedError}})
+		if err := cp.ChangePassword(aws.String("ACCESS_TOKEN"), aws.String("old password"), aws.String("new password")); err != expectedError {
+			t.Errorf("Expected error")
+		}
+	})
+	t.Run("Missing parameters on ChangePassword", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{})
+		if err := cp.ChangePassword(aws.String("ACCESS_TOKEN"), nil, aws.String("new password")); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+	})
+}
+
+func TestForgotPassword(t *testing.T) {
+	expectedError := errors.New("Something went wrong")
+
+	t.Run("Successfull ForgotPassword", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{forgotPasswordRequest: mockRequest()})
+		if err := cp.ForgotPassword(aws.String("username")); err != nil {
+			t.Errorf(err.Error())
+		}
+	})
+	t.Run("Fail ForgotPassword", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{forgotPasswordRequest: &request.Request{Error: expectedError}})
+		if err := cp.ForgotPassword(aws.String("username")); err != expectedError {
+			t.Errorf("Expected error")
+		}
+	})
+	t.Run("Successfull ConfirmForgotPassword", func(t *testing.T) {
+		mock := &mockedCognitoClient{confirmForgotPasswordRequest: mockRequest()}
+		cp := NewCognitoHandler("client", "userpool", mock)
+		if err := cp.ConfirmForgotPassword(aws.String("username"), aws.String("123456"), aws.String("new password")); err != nil {
+			t.Fatal(err)
+		}
+		if *mock.confirmForgotPasswordInput.ConfirmationCode != "123456" || *mock.confirmForgotPasswordInput.Password != "new password" {
+			t.Errorf("Input does not match the expected value")
+		}
+	})
+	t.Run("Missing parameters on password reset", func(t *testing.T) {
+		cp := NewCognitoHandler("client", "userpool", &mockedCognitoClient{})
+		if err := cp.ForgotPassword(nil); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+		if err := cp.ConfirmForgotPassword(aws.String("username"), nil, nil); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+	})
 }
@@ -0,0 +1,1436 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	fakeAccessTokenTTL = time.Hour
+	fakeSessionTTL     = 3 * time.Minute
+	fakeResetCodeTTL   = time.Hour
+	fakeScope          = "aws.cognito.signin.user.admin"
+
+	totpPeriod = 30
+	totpDigits = 6
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// FakeUser seeds the in-memory user pool
+type FakeUser struct {
+	Username string
+	Password string
+	Groups   []string
+}
+
+// FakeClient seeds the app clients allowed to use the client_credentials grant
+type FakeClient struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+type fakeUser struct {
+	sub          string
+	username     string
+	passwordHash []byte
+	status       string
+	enabled      bool
+	created      time.Time
+	modified     time.Time
+	groups       []string
+
+	// totpSecret is the verified authenticator app, pendingTOTPSecret the one being enrolled
+	totpSecret        string
+	pendingTOTPSecret string
+	totpEnabled       bool
+	totpPreferred     bool
+
+	resetCode    string
+	resetExpires time.Time
+
+	attributes  map[string]string
+	confirmCode string
+}
+
+type fakeGroup struct {
+	name        string
+	description *string
+	precedence  *int64
+	created     time.Time
+	modified    time.Time
+}
+
+// fakeRefreshToken is a login session, the access tokens it issues share its origin_jti
+type fakeRefreshToken struct {
+	username  string
+	originJTI string
+}
+
+// fakeSession tracks a login waiting for the answer to its challenge
+type fakeSession struct {
+	username  string
+	challenge string
+	expires   time.Time
+}
+
+type fakeCognito struct {
+	issuer      string
+	appClientID string
+	kid         string
+	signingKey  *rsa.PrivateKey
+
+	clients map[string]FakeClient
+
+	mu            sync.RWMutex
+	users         map[string]*fakeUser
+	groups        map[string]*fakeGroup
+	refreshTokens map[string]fakeRefreshToken
+	// revokedOrigins are the origin_jti of the signed out sessions, their access tokens are refused
+	revokedOrigins map[string]bool
+	sessions       map[string]fakeSession
+}
+
+// NewFakeCognitoHandler returns an in-memory user pool that signs its own tokens with the
+// same claims Cognito emits, together with the key source publishing its signing key.
+// It is meant for local development and tests, never for production.
+func NewFakeCognitoHandler(region, userPoolID, appClientID string, users []FakeUser, clients []FakeClient) (entities.UserTokenHandler, entities.KeySource, error) {
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	f := &fakeCognito{
+		issuer:         fmt.Sprintf("https://cognito-idp.%v.amazonaws.com/%v", region, userPoolID),
+		appClientID:    appClientID,
+		kid:            randomToken(16),
+		signingKey:     signingKey,
+		clients:        map[string]FakeClient{},
+		users:          map[string]*fakeUser{},
+		groups:         map[string]*fakeGroup{},
+		refreshTokens:  map[string]fakeRefreshToken{},
+		revokedOrigins: map[string]bool{},
+		sessions:       map[string]fakeSession{},
+	}
+	for _, user := range users {
+		if _, err := f.addUser(user.Username, user.Password, user.Groups); err != nil {
+			return nil, nil, err
+		}
+		for _, group := range user.Groups {
+			if _, ok := f.groups[group]; !ok {
+				f.addGroup(group)
+			}
+		}
+	}
+	for _, client := range clients {
+		f.clients[client.ClientID] = client
+	}
+
+	jwks := &entities.JSONWebKeySet{
+		Keys: []entities.JSONWebKey{{
+			Alg: "RS256",
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(signingKey.E)).Bytes()),
+			Kid: f.kid,
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(signingKey.N.Bytes()),
+			Use: "sig",
+		}},
+	}
+	return f, NewStaticKeySource(jwks), nil
+}
+
+func (f *fakeCognito) GetTokens(username, password *string) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
+
+	if username == nil || password == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Getting access token from fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[*username]
+	if !ok || subtle.ConstantTimeCompare(user.passwordHash, hashPassword(*password)) != 1 {
+		err = awserr.New("NotAuthorizedException", "Incorrect username or password.", nil)
+		return
+	}
+	if !user.enabled {
+		err = awserr.New("NotAuthorizedException", "User is disabled.", nil)
+		return
+	}
+	if user.status == "UNCONFIRMED" {
+		err = awserr.New("UserNotConfirmedException", "User is not confirmed.", nil)
+		return
+	}
+	return f.nextStep(user)
+}
+
+func (f *fakeCognito) RespondToChallenge(request *entities.ChallengeRequest) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
+
+	if request == nil || request.ChallengeName == nil || request.Session == nil || request.Username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Infof("Responding to %v challenge in fake user pool\n", *request.ChallengeName)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, ok := f.sessions[*request.Session]
+	if !ok || session.username != *request.Username || time.Now().After(session.expires) ||
+		session.challenge != *request.ChallengeName {
+		err = awserr.New("NotAuthorizedException", "Invalid session for the user.", nil)
+		return
+	}
+	user, ok := f.users[session.username]
+	if !ok || !user.enabled {
+		err = awserr.New("NotAuthorizedException", "User is disabled.", nil)
+		return
+	}
+
+	// The fake user pool only issues NEW_PASSWORD_REQUIRED and SOFTWARE_TOKEN_MFA challenges
+	switch session.challenge {
+	case "NEW_PASSWORD_REQUIRED":
+		if request.NewPassword == nil {
+			err = ErrorInvalidInputParameters
+			return
+		}
+		if err = validatePassword(*request.NewPassword); err != nil {
+			return
+		}
+		user.passwordHash = hashPassword(*request.NewPassword)
+		user.status = "CONFIRMED"
+	case "SOFTWARE_TOKEN_MFA":
+		if request.Code == nil {
+			err = ErrorInvalidInputParameters
+			return
+		}
+		if !validTOTPCode(user.totpSecret, *request.Code, time.Now()) {
+			err = awserr.New("CodeMismatchException", "Invalid code received for user", nil)
+			return
+		}
+		delete(f.sessions, *request.Session)
+		return f.loginTokens(user)
+	}
+	delete(f.sessions, *request.Session)
+	return f.nextStep(user)
+}
+
+// nextStep must be called holding mu, it returns the challenge left to the user or the tokens
+func (f *fakeCognito) nextStep(user *fakeUser) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
+	name := ""
+	parameters := map[string]*string{
+		"USER_ID_FOR_SRP": aws.String(user.username),
+	}
+	switch {
+	case user.status == "FORCE_CHANGE_PASSWORD":
+		name = "NEW_PASSWORD_REQUIRED"
+		parameters["userAttributes"] = aws.String("{}")
+		parameters["requiredAttributes"] = aws.String("[]")
+	case user.totpEnabled:
+		name = "SOFTWARE_TOKEN_MFA"
+	default:
+		return f.loginTokens(user)
+	}
+
+	session := randomToken(32)
+	f.sessions[session] = fakeSession{username: user.username, challenge: name, expires: time.Now().Add(fakeSessionTTL)}
+	challenge = &entities.Challenge{
+		Name:       aws.String(name),
+		Session:    aws.String(session),
+		Parameters: parameters,
+	}
+	return
+}
+
+// loginTokens must be called holding mu
+func (f *fakeCognito) loginTokens(user *fakeUser) (tokens *entities.Tokens, challenge *entities.Challenge, err error) {
+	refreshToken := randomToken(32)
+	session := fakeRefreshToken{username: user.username, originJTI: newUUID()}
+	tokens, err = f.issueTokens(user, aws.String(refreshToken), session.originJTI)
+	if err != nil {
+		return
+	}
+	f.refreshTokens[refreshToken] = session
+	return
+}
+
+func (f *fakeCognito) RefreshAccessToken(token *string) (tokens *entities.Tokens, err error) {
+
+	if token == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Refreshing token from fake user pool")
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	session, ok := f.refreshTokens[*token]
+	if !ok {
+		err = awserr.New("NotAuthorizedException", "Invalid Refresh Token", nil)
+		return
+	}
+	user, ok := f.users[session.username]
+	if !ok || !user.enabled {
+		err = awserr.New("NotAuthorizedException", "Refresh Token has been revoked", nil)
+		return
+	}
+	return f.issueTokens(user, token, session.originJTI)
+}
+
+// RevokeToken succeeds for unknown tokens, like the revocation of RFC 7009
+func (f *fakeCognito) RevokeToken(refreshToken *string) (err error) {
+
+	if refreshToken == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Revoking refresh token in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if session, ok := f.refreshTokens[*refreshToken]; ok {
+		delete(f.refreshTokens, *refreshToken)
+		f.revokedOrigins[session.originJTI] = true
+	}
+	return
+}
+
+func (f *fakeCognito) GlobalSignOut(accessToken *string) (err error) {
+
+	log.Info("Signing out user in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.userFromAccessToken(accessToken)
+	if err != nil {
+		return
+	}
+	f.signOut(user.username)
+	return
+}
+
+func (f *fakeCognito) AdminGlobalSignOut(username *string) (err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Signing out user as administrator in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err = f.adminUser(*username); err != nil {
+		return
+	}
+	f.signOut(*username)
+	return
+}
+
+// signOut revokes every session of the user, the caller holds the lock
+func (f *fakeCognito) signOut(username string) {
+	for token, session := range f.refreshTokens {
+		if session.username == username {
+			delete(f.refreshTokens, token)
+			f.revokedOrigins[session.originJTI] = true
+		}
+	}
+}
+
+func (f *fakeCognito) AuthenticateClient(clientID, clientSecret *string) (err error) {
+
+	if clientID == nil || clientSecret == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	client, ok := f.clients[*clientID]
+	if !ok || subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(*clientSecret)) != 1 {
+		err = &entities.OAuthError{Code: "invalid_client", Description: "Invalid client credentials"}
+	}
+	return
+}
+
+func (f *fakeCognito) GetClientCredentialsTokens(clientID, clientSecret, scope *string) (tokens *entities.Tokens, err error) {
+
+	if clientID == nil || clientSecret == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Getting client credentials token from fake user pool")
+	client, ok := f.clients[*clientID]
+	if !ok || subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(*clientSecret)) != 1 {
+		err = &entities.OAuthError{Code: "invalid_client"}
+		return
+	}
+
+	// Like Cognito, grant every allowed scope unless a subset is requested
+	granted := client.Scopes
+	if scope != nil && *scope != "" {
+		granted = strings.Fields(*scope)
+		for _, requested := range granted {
+			if !containsString(client.Scopes, requested) {
+				err = &entities.OAuthError{Code: "invalid_scope"}
+				return
+			}
+		}
+	}
+
+	now := time.Now()
+	accessToken, err := f.sign(jwt.MapClaims{
+		"sub":       client.ClientID,
+		"iss":       f.issuer,
+		"client_id": client.ClientID,
+		"token_use": "access",
+		"scope":     strings.Join(granted, " "),
+		"auth_time": now.Unix(),
+		"exp":       now.Add(fakeAccessTokenTTL).Unix(),
+		"iat":       now.Unix(),
+		"jti":       newUUID(),
+		"version":   2,
+	})
+	if err != nil {
+		return
+	}
+	tokens = &entities.Tokens{
+		AccessToken: accessToken,
+		TokenType:   aws.String("Bearer"),
+		ExpiresIn:   aws.Int64(int64(fakeAccessTokenTTL.Seconds())),
+		Scope:       aws.String(strings.Join(granted, " ")),
+	}
+	return
+}
+
+// RegisterUser signs up an unconfirmed user, the confirmation code is logged instead of sent
+func (f *fakeCognito) RegisterUser(request *entities.RegistrationRequest) (registration *entities.Registration, err error) {
+
+	if request == nil || request.Username == nil || request.Password == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Registering new user in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.addUser(*request.Username, *request.Password, nil)
+	if err != nil {
+		return
+	}
+	user.status = "UNCONFIRMED"
+	if request.Email != nil {
+		user.attributes["email"] = *request.Email
+	}
+	if request.PhoneNumber != nil {
+		user.attributes["phone_number"] = *request.PhoneNumber
+	}
+	registration = &entities.Registration{
+		Sub:                 aws.String(user.sub),
+		UserConfirmed:       aws.Bool(false),
+		CodeDeliveryDetails: f.sendConfirmationCode(user),
+	}
+	return
+}
+
+func (f *fakeCognito) ConfirmSignUp(username, code *string) (err error) {
+
+	if username == nil || code == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Confirming sign up in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[*username]
+	if !ok {
+		err = awserr.New("UserNotFoundException", "Username/client id combination not found.", nil)
+		return
+	}
+	if user.status != "UNCONFIRMED" {
+		err = awserr.New("NotAuthorizedException", "User cannot be confirmed. Current status is "+user.status, nil)
+		return
+	}
+	if user.confirmCode == "" || subtle.ConstantTimeCompare([]byte(user.confirmCode), []byte(*code)) != 1 {
+		err = awserr.New("CodeMismatchException", "Invalid verification code provided, please try again.", nil)
+		return
+	}
+	user.status = "CONFIRMED"
+	user.confirmCode = ""
+	// The code was delivered by email, which verifies the address
+	if _, ok := user.attributes["email"]; ok {
+		user.attributes["email_verified"] = "true"
+	}
+	user.modified = time.Now()
+	return
+}
+
+func (f *fakeCognito) ResendConfirmationCode(username *string) (delivery *entities.CodeDeliveryDetails, err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[*username]
+	if !ok {
+		err = awserr.New("UserNotFoundException", "Username/client id combination not found.", nil)
+		return
+	}
+	if user.status != "UNCONFIRMED" {
+		err = awserr.New("InvalidParameterException", "User is already confirmed.", nil)
+		return
+	}
+	delivery = f.sendConfirmationCode(user)
+	return
+}
+
+// sendConfirmationCode must be called holding mu, the code goes to the email or else the phone number
+func (f *fakeCognito) sendConfirmationCode(user *fakeUser) *entities.CodeDeliveryDetails {
+	user.confirmCode = randomDigits(6)
+	log.Infof("Fake user pool confirmation code for [%v]: %v\n", user.username, user.confirmCode)
+	if email, ok := user.attributes["email"]; ok {
+		return &entities.CodeDeliveryDetails{
+			Destination:    aws.String(maskDestination(email)),
+			DeliveryMedium: aws.String("EMAIL"),
+			AttributeName:  aws.String("email"),
+		}
+	}
+	if phoneNumber, ok := user.attributes["phone_number"]; ok {
+		return &entities.CodeDeliveryDetails{
+			Destination:    aws.String(maskDestination(phoneNumber)),
+			DeliveryMedium: aws.String("SMS"),
+			AttributeName:  aws.String("phone_number"),
+		}
+	}
+	return nil
+}
+
+// CreateUser logs the invitation instead of sending it
+func (f *fakeCognito) CreateUser(request *entities.CreateUserRequest) (user *entities.UserModel, err error) {
+
+	if err = validateCreateUserRequest(request); err != nil {
+		return
+	}
+
+	log.Info("Creating user in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	temporaryPassword := randomToken(8)
+	if request.TemporaryPassword != nil {
+		temporaryPassword = *request.TemporaryPassword
+	}
+	created, ok := f.users[*request.Username]
+	resend := request.MessageAction != nil && *request.MessageAction == "RESEND"
+	switch {
+	case resend && !ok:
+		err = awserr.New("UserNotFoundException", "User does not exist.", nil)
+		return
+	case resend && created.status != "FORCE_CHANGE_PASSWORD":
+		err = awserr.New("UnsupportedUserStateException", "Resend not possible. "+*request.Username+" status is not FORCE_CHANGE_PASSWORD", nil)
+		return
+	case resend:
+		if err = validatePassword(temporaryPassword); err != nil {
+			return
+		}
+		created.passwordHash = hashPassword(temporaryPassword)
+	default:
+		if created, err = f.addUser(*request.Username, temporaryPassword, nil); err != nil {
+			return
+		}
+		created.status = "FORCE_CHANGE_PASSWORD"
+		if request.Email != nil {
+			created.attributes["email"] = *request.Email
+		}
+		if request.PhoneNumber != nil {
+			created.attributes["phone_number"] = *request.PhoneNumber
+		}
+		for name, value := range request.Attributes {
+			created.attributes[name] = value
+		}
+	}
+	if request.MessageAction == nil || *request.MessageAction != "SUPPRESS" {
+		log.Infof("Fake user pool temporary password for [%v]: %v\n", created.username, temporaryPassword)
+	}
+	created.modified = time.Now()
+	model := created.model(nil)
+	user = &model
+	return
+}
+
+func (f *fakeCognito) ListUsers(request *entities.ListUsersRequest) (page *entities.UserPage, err error) {
+
+	if request == nil {
+		request = &entities.ListUsersRequest{}
+	}
+	limit, err := pageLimit(request.Limit)
+	if err != nil {
+		return
+	}
+	// The pagination token of the fake user pool is the username the next page starts at
+	start, err := decodeCursor(request.Cursor)
+	if err != nil {
+		return
+	}
+	var filter *userFilter
+	if request.Filter != nil && *request.Filter != "" {
+		if filter, err = parseUserFilter(*request.Filter); err != nil {
+			return
+		}
+	}
+
+	log.Info("Getting users from fake user pool")
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	usernames := []string{}
+	for username, user := range f.users {
+		if (start == nil || username >= *start) && (filter == nil || filter.matches(user.attribute(filter.attribute))) {
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+
+	page = &entities.UserPage{Users: []entities.UserModel{}}
+	if int64(len(usernames)) > limit {
+		page.NextCursor = encodeCursor(aws.String(usernames[limit]))
+		usernames = usernames[:limit]
+	}
+	for _, username := range usernames {
+		model := f.users[username].model(request.Attributes)
+		if request.IncludeGroups {
+			model.Groups = f.users[username].groupNames()
+		}
+		page.Users = append(page.Users, model)
+	}
+	return
+}
+
+func (f *fakeCognito) GetUser(username *string) (user *entities.UserModel, err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	found, err := f.adminUser(*username)
+	if err != nil {
+		return
+	}
+	model := found.model(nil)
+	user = &model
+	return
+}
+
+func (f *fakeCognito) UpdateUserAttributes(username *string, attributes map[string]string) (err error) {
+
+	if username == nil || len(attributes) == 0 {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Updating user attributes in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.adminUser(*username)
+	if err != nil {
+		return
+	}
+	for name := range attributes {
+		if name == "sub" {
+			err = awserr.New("InvalidParameterException", "Cannot modify an immutable attribute: sub", nil)
+			return
+		}
+	}
+	for name, value := range attributes {
+		user.attributes[name] = value
+	}
+	// A new email must be verified again, unless the administrator verifies it
+	if _, ok := attributes["email"]; ok {
+		if _, ok := attributes["email_verified"]; !ok {
+			delete(user.attributes, "email_verified")
+		}
+	}
+	user.modified = time.Now()
+	return
+}
+
+func (f *fakeCognito) DeleteUserAttributes(username *string, names []string) (err error) {
+
+	if username == nil || len(names) == 0 {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Deleting user attributes in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.adminUser(*username)
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		if name == "sub" {
+			err = awserr.New("InvalidParameterException", "Cannot modify an immutable attribute: sub", nil)
+			return
+		}
+	}
+	for _, name := range names {
+		delete(user.attributes, name)
+	}
+	user.modified = time.Now()
+	return
+}
+
+func (f *fakeCognito) DeleteUser(username *string) (err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Deleting user in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err = f.adminUser(*username); err != nil {
+		return
+	}
+	delete(f.users, *username)
+	return
+}
+
+func (f *fakeCognito) EnableUser(username *string) error {
+	return f.setUserEnabled(username, true)
+}
+
+func (f *fakeCognito) DisableUser(username *string) error {
+	return f.setUserEnabled(username, false)
+}
+
+func (f *fakeCognito) setUserEnabled(username *string, enabled bool) (err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.adminUser(*username)
+	if err != nil {
+		return
+	}
+	user.enabled = enabled
+	user.modified = time.Now()
+	return
+}
+
+// adminUser looks a user up like the Admin* APIs, the caller holds the lock
+func (f *fakeCognito) adminUser(username string) (*fakeUser, error) {
+	user, ok := f.users[username]
+	if !ok {
+		return nil, awserr.New("UserNotFoundException", "User does not exist.", nil)
+	}
+	return user, nil
+}
+
+func (f *fakeCognito) ListGroups(request *entities.PageRequest) (page *entities.GroupPage, err error) {
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	names := []string{}
+	for name := range f.groups {
+		names = append(names, name)
+	}
+	return f.groupPage(names, request)
+}
+
+func (f *fakeCognito) CreateGroup(request *entities.CreateGroupRequest) (group *entities.Group, err error) {
+
+	if request == nil || request.Name == nil || *request.Name == "" {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Creating group in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.groups[*request.Name]; ok {
+		err = awserr.New("GroupExistsException", "A group with the name already exists.", nil)
+		return
+	}
+	created := f.addGroup(*request.Name)
+	created.description = request.Description
+	created.precedence = request.Precedence
+	model := created.model()
+	group = &model
+	return
+}
+
+func (f *fakeCognito) DeleteGroup(name *string) (err error) {
+
+	if name == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Deleting group in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err = f.group(*name); err != nil {
+		return
+	}
+	delete(f.groups, *name)
+	for _, user := range f.users {
+		user.groups = removeString(user.groups, *name)
+	}
+	return
+}
+
+func (f *fakeCognito) AddUserToGroup(username, group *string) (err error) {
+
+	if username == nil || group == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Adding user to group in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.adminUser(*username)
+	if err != nil {
+		return
+	}
+	if _, err = f.group(*group); err != nil {
+		return
+	}
+	if !containsString(user.groups, *group) {
+		user.groups = append(user.groups, *group)
+	}
+	return
+}
+
+func (f *fakeCognito) RemoveUserFromGroup(username, group *string) (err error) {
+
+	if username == nil || group == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Removing user from group in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.adminUser(*username)
+	if err != nil {
+		return
+	}
+	if _, err = f.group(*group); err != nil {
+		return
+	}
+	user.groups = removeString(user.groups, *group)
+	return
+}
+
+func (f *fakeCognito) ListGroupsForUser(username *string, request *entities.PageRequest) (page *entities.GroupPage, err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	user, err := f.adminUser(*username)
+	if err != nil {
+		return
+	}
+	return f.groupPage(user.groups, request)
+}
+
+func (f *fakeCognito) ListUsersInGroup(group *string, request *entities.PageRequest) (page *entities.UserPage, err error) {
+
+	if group == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if _, err = f.group(*group); err != nil {
+		return
+	}
+	usernames := []string{}
+	for username, user := range f.users {
+		if containsString(user.groups, *group) {
+			usernames = append(usernames, username)
+		}
+	}
+	usernames, nextCursor, err := fakePage(usernames, request)
+	if err != nil {
+		return
+	}
+	page = &entities.UserPage{Users: []entities.UserModel{}, NextCursor: nextCursor}
+	for _, username := range usernames {
+		page.Users = append(page.Users, f.users[username].model(nil))
+	}
+	return
+}
+
+func (f *fakeCognito) UserGroups(username *string) (groups []string, err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	user, err := f.adminUser(*username)
+	if err != nil {
+		return
+	}
+	return user.groupNames(), nil
+}
+
+// groupPage is a page of the named groups, the caller holds the lock
+func (f *fakeCognito) groupPage(names []string, request *entities.PageRequest) (*entities.GroupPage, error) {
+	names, nextCursor, err := fakePage(names, request)
+	if err != nil {
+		return nil, err
+	}
+	page := &entities.GroupPage{Groups: []entities.Group{}, NextCursor: nextCursor}
+	for _, name := range names {
+		page.Groups = append(page.Groups, f.groups[name].model())
+	}
+	return page, nil
+}
+
+// group looks a group up, the caller holds the lock
+func (f *fakeCognito) group(name string) (*fakeGroup, error) {
+	group, ok := f.groups[name]
+	if !ok {
+		return nil, awserr.New("ResourceNotFoundException", "Group not found.", nil)
+	}
+	return group, nil
+}
+
+// addGroup creates the group, the caller holds the lock
+func (f *fakeCognito) addGroup(name string) *fakeGroup {
+	now := time.Now()
+	group := &fakeGroup{name: name, created: now, modified: now}
+	f.groups[name] = group
+	return group
+}
+
+func (g *fakeGroup) model() entities.Group {
+	return entities.Group{
+		Name:         aws.String(g.name),
+		Description:  g.description,
+		Precedence:   g.precedence,
+		Created:      aws.Time(g.created),
+		LastModified: aws.Time(g.modified),
+	}
+}
+
+// groupNames are the sorted groups of the user
+func (u *fakeUser) groupNames() []string {
+	groups := append([]string{}, u.groups...)
+	sort.Strings(groups)
+	return groups
+}
+
+// fakePage sorts the names and returns the requested page,
+// the pagination token of the fake user pool is the name the next page starts at
+func fakePage(names []string, request *entities.PageRequest) (page []string, nextCursor *string, err error) {
+	limit, start, err := pageParameters(request)
+	if err != nil {
+		return
+	}
+	page = []string{}
+	for _, name := range names {
+		if start == nil || name >= *start {
+			page = append(page, name)
+		}
+	}
+	sort.Strings(page)
+	if int64(len(page)) > limit {
+		nextCursor = encodeCursor(aws.String(page[limit]))
+		page = page[:limit]
+	}
+	return
+}
+
+func removeString(values []string, value string) []string {
+	kept := []string{}
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// model maps the user with the given attributes, or all of them like Cognito does when none is requested
+func (u *fakeUser) model(attributes []string) entities.UserModel {
+	model := entities.UserModel{
+		Username:     aws.String(u.username),
+		Status:       aws.String(u.status),
+		Enabled:      aws.Bool(u.enabled),
+		Created:      aws.Time(u.created),
+		LastModified: aws.Time(u.modified),
+	}
+	if len(attributes) == 0 {
+		attributes = []string{"sub"}
+		for name := range u.attributes {
+			attributes = append(attributes, name)
+		}
+	}
+	for _, name := range attributes {
+		if value := u.attribute(name); value != "" {
+			model.SetAttribute(name, value)
+		}
+	}
+	return model
+}
+
+// attribute is the value of a user attribute, including the ones Cognito filters on
+func (u *fakeUser) attribute(name string) string {
+	switch name {
+	case "username":
+		return u.username
+	case "sub":
+		return u.sub
+	case "cognito:user_status":
+		return u.status
+	}
+	return u.attributes[name]
+}
+
+func (f *fakeCognito) AssociateSoftwareToken(accessToken *string) (secretCode *string, err error) {
+
+	log.Info("Associating software token in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.userFromAccessToken(accessToken)
+	if err != nil {
+		return
+	}
+	secret := make([]byte, 20)
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	user.pendingTOTPSecret = totpEncoding.EncodeToString(secret)
+	secretCode = aws.String(user.pendingTOTPSecret)
+	return
+}
+
+func (f *fakeCognito) VerifySoftwareToken(accessToken, code, deviceName *string) (err error) {
+
+	if code == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Verifying software token in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.userFromAccessToken(accessToken)
+	if err != nil {
+		return
+	}
+	if user.pendingTOTPSecret == "" {
+		err = awserr.New("InvalidParameterException", "Software token has not been associated", nil)
+		return
+	}
+	if !validTOTPCode(user.pendingTOTPSecret, *code, time.Now()) {
+		err = awserr.New("EnableSoftwareTokenMFAException", "Code mismatch", nil)
+		return
+	}
+	user.totpSecret = user.pendingTOTPSecret
+	user.pendingTOTPSecret = ""
+	return
+}
+
+func (f *fakeCognito) SetSoftwareTokenMFAPreference(accessToken *string, enabled, preferred bool) (err error) {
+
+	log.Info("Setting software token MFA preference in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.userFromAccessToken(accessToken)
+	if err != nil {
+		return
+	}
+	if enabled && user.totpSecret == "" {
+		err = awserr.New("InvalidParameterException", "User has not verified software token mfa", nil)
+		return
+	}
+	user.totpEnabled = enabled
+	user.totpPreferred = enabled && preferred
+	return
+}
+
+func (f *fakeCognito) GetMFASettings(accessToken *string) (settings *entities.MFASettings, err error) {
+
+	log.Info("Getting MFA settings from fake user pool")
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	user, err := f.userFromAccessToken(accessToken)
+	if err != nil {
+		return
+	}
+	settings = &entities.MFASettings{Enabled: []string{}}
+	if user.totpEnabled {
+		settings.Enabled = append(settings.Enabled, "SOFTWARE_TOKEN_MFA")
+	}
+	if user.totpPreferred {
+		settings.Preferred = aws.String("SOFTWARE_TOKEN_MFA")
+	}
+	return
+}
+
+func (f *fakeCognito) ChangePassword(accessToken, currentPassword, newPassword *string) (err error) {
+
+	if currentPassword == nil || newPassword == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Changing password in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, err := f.userFromAccessToken(accessToken)
+	if err != nil {
+		return
+	}
+	if subtle.ConstantTimeCompare(user.passwordHash, hashPassword(*currentPassword)) != 1 {
+		err = awserr.New("NotAuthorizedException", "Incorrect username or password.", nil)
+		return
+	}
+	if err = validatePassword(*newPassword); err != nil {
+		return
+	}
+	user.passwordHash = hashPassword(*newPassword)
+	return
+}
+
+// ForgotPassword logs the code instead of sending it, the offline pool has nowhere to deliver it
+func (f *fakeCognito) ForgotPassword(username *string) (err error) {
+
+	if username == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[*username]
+	if !ok {
+		err = awserr.New("UserNotFoundException", "Username/client id combination not found.", nil)
+		return
+	}
+	user.resetCode = randomDigits(6)
+	user.resetExpires = time.Now().Add(fakeResetCodeTTL)
+	log.Infof("Fake user pool password reset code for [%v]: %v\n", user.username, user.resetCode)
+	return
+}
+
+func (f *fakeCognito) ConfirmForgotPassword(username, code, newPassword *string) (err error) {
+
+	if username == nil || code == nil || newPassword == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+
+	log.Info("Confirming forgot password in fake user pool")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[*username]
+	if !ok {
+		err = awserr.New("UserNotFoundException", "Username/client id combination not found.", nil)
+		return
+	}
+	if user.resetCode == "" || subtle.ConstantTimeCompare([]byte(user.resetCode), []byte(*code)) != 1 {
+		err = awserr.New("CodeMismatchException", "Invalid verification code provided, please try again.", nil)
+		return
+	}
+	if time.Now().After(user.resetExpires) {
+		err = awserr.New("ExpiredCodeException", "Invalid code provided, please request a code again.", nil)
+		return
+	}
+	if err = validatePassword(*newPassword); err != nil {
+		return
+	}
+	user.passwordHash = hashPassword(*newPassword)
+	user.resetCode = ""
+	return
+}
+
+// userFromAccessToken must be called holding mu, like Cognito it only accepts user access tokens
+func (f *fakeCognito) userFromAccessToken(accessToken *string) (*fakeUser, error) {
+	if accessToken == nil {
+		return nil, ErrorInvalidInputParameters
+	}
+	invalid := awserr.New("NotAuthorizedException", "Invalid Access Token", nil)
+	token, err := jwt.Parse(*accessToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return f.signingKey.Public(), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, invalid
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	username, _ := claims["username"].(string)
+	if claims["token_use"] != "access" || username == "" {
+		return nil, invalid
+	}
+	if origin, _ := claims["origin_jti"].(string); f.revokedOrigins[origin] {
+		return nil, awserr.New("NotAuthorizedException", "Access Token has been revoked", nil)
+	}
+	user, ok := f.users[username]
+	if !ok || !user.enabled {
+		return nil, invalid
+	}
+	return user, nil
+}
+
+// addUser must be called holding mu (or before the pool is shared)
+func (f *fakeCognito) addUser(username, password string, groups []string) (*fakeUser, error) {
+	if username == "" {
+		return nil, awserr.New("InvalidParameterException", "Username cannot be empty.", nil)
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+	if _, ok := f.users[username]; ok {
+		return nil, awserr.New("UsernameExistsException", "User already exists", nil)
+	}
+	now := time.Now()
+	user := &fakeUser{
+		sub:          newUUID(),
+		username:     username,
+		passwordHash: hashPassword(password),
+		status:       "CONFIRMED",
+		enabled:      true,
+		created:      now,
+		modified:     now,
+		groups:       groups,
+		attributes:   map[string]string{},
+	}
+	f.users[username] = user
+	return user, nil
+}
+
+func (f *fakeCognito) issueTokens(user *fakeUser, refreshToken *string, originJTI string) (*entities.Tokens, error) {
+	now := time.Now()
+	accessToken, err := f.sign(f.accessTokenClaims(user, now, originJTI))
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := f.sign(f.idTokenClaims(user, now))
+	if err != nil {
+		return nil, err
+	}
+	return &entities.Tokens{
+		AccessToken:  accessToken,
+		IDToken:      idToken,
+		RefreshToken: refreshToken,
+		TokenType:    aws.String("Bearer"),
+		ExpiresIn:    aws.Int64(int64(fakeAccessTokenTTL.Seconds())),
+		Scope:        aws.String(fakeScope),
+	}, nil
+}
+
+func (f *fakeCognito) accessTokenClaims(user *fakeUser, now time.Time, originJTI string) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":        user.sub,
+		"iss":        f.issuer,
+		"client_id":  f.appClientID,
+		"origin_jti": originJTI,
+		"event_id":   newUUID(),
+		"token_use":  "access",
+		"scope":      fakeScope,
+		"auth_time":  now.Unix(),
+		"exp":        now.Add(fakeAccessTokenTTL).Unix(),
+		"iat":        now.Unix(),
+		"jti":        newUUID(),
+		"username":   user.username,
+	}
+	if len(user.groups) > 0 {
+		claims["cognito:groups"] = user.groups
+	}
+	return claims
+}
+
+func (f *fakeCognito) idTokenClaims(user *fakeUser, now time.Time) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":              user.sub,
+		"aud":              f.appClientID,
+		"iss":              f.issuer,
+		"event_id":         newUUID(),
+		"token_use":        "id",
+		"auth_time":        now.Unix(),
+		"exp":              now.Add(fakeAccessTokenTTL).Unix(),
+		"iat":              now.Unix(),
+		"cognito:username": user.username,
+	}
+	if len(user.groups) > 0 {
+		claims["cognito:groups"] = user.groups
+	}
+	return claims
+}
+
+func (f *fakeCognito) sign(claims jwt.MapClaims) (*string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = f.kid
+	signed, err := token.SignedString(f.signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return aws.String(signed), nil
+}
+
+// validatePassword applies the minimum length of the default Cognito password policy
+func validatePassword(password string) error {
+	if len(password) < 8 {
+		return awserr.New("InvalidPasswordException", "Password did not conform with policy: Password not long enough", nil)
+	}
+	return nil
+}
+
+// maskDestination hides a contact the way Cognito does, e.g. j***@e*** or +*******1234
+func maskDestination(destination string) string {
+	if at := strings.Index(destination, "@"); at > 0 && at < len(destination)-1 {
+		return destination[:1] + "***@" + destination[at+1:at+2] + "***"
+	}
+	if len(destination) > 4 {
+		return destination[:1] + strings.Repeat("*", len(destination)-5) + destination[len(destination)-4:]
+	}
+	return "***"
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hashPassword(password string) []byte {
+	sum := sha256.Sum256([]byte(password))
+	return sum[:]
+}
+
+func randomToken(length int) string {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func randomDigits(length int) string {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = '0' + b[i]%10
+	}
+	return string(b)
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// totpCode is the RFC 6238 code of the base32 secret at the given time (HMAC-SHA1, 30 seconds, 6 digits)
+func totpCode(secret string, at time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(at.Unix()/totpPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// validTOTPCode accepts the codes of the previous and next periods to allow for clock drift
+func validTOTPCode(secret, code string, now time.Time) bool {
+	if secret == "" {
+		return false
+	}
+	for _, skew := range []int64{-1, 0, 1} {
+		expected, err := totpCode(secret, now.Add(time.Duration(skew*totpPeriod)*time.Second))
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
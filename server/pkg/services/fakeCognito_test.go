@@ -0,0 +1,683 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+func newTestFakeCognito(t *testing.T) (*fakeCognito, entities.KeySource) {
+	handler, source, err := NewFakeCognitoHandler("us-west-2", "us-west-2_test", "client", []FakeUser{
+		{Username: "admin", Password: "password1", Groups: []string{"admin"}},
+	}, []FakeClient{
+		{ClientID: "machine", ClientSecret: "secret", Scopes: []string{"users/read", "users/write"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler.(*fakeCognito), source
+}
+
+func TestFakeCognitoGetTokens(t *testing.T) {
+	f, source := newTestFakeCognito(t)
+	keys := NewJWKSCache(source, time.Hour, time.Hour)
+	defer keys.Close()
+
+	t.Run("Successfull GetTokens", func(t *testing.T) {
+		tokens, _, err := f.GetTokens(aws.String("admin"), aws.String("password1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens.RefreshToken == nil || *tokens.RefreshToken == "" {
+			t.Errorf("Refresh token expected")
+		}
+		if tokens.IDToken == nil || *tokens.ExpiresIn != 3600 || *tokens.Scope != fakeScope {
+			t.Errorf("Tokens do not match the expected value")
+		}
+		token, err := jwt.Parse(*tokens.AccessToken, func(token *jwt.Token) (interface{}, error) {
+			return keys.GetKey(token.Header["kid"].(string))
+		})
+		if err != nil || !token.Valid {
+			t.Fatalf("Access token should verify against the published JWKS: %v", err)
+		}
+		claims := token.Claims.(jwt.MapClaims)
+		expected := map[string]string{
+			"iss":       "https://cognito-idp.us-west-2.amazonaws.com/us-west-2_test",
+			"token_use": "access",
+			"client_id": "client",
+			"username":  "admin",
+		}
+		for claim, value := range expected {
+			if claims[claim] != value {
+				t.Errorf("Claim %v does not match the expected value", claim)
+			}
+		}
+		groups, ok := claims["cognito:groups"].([]interface{})
+		if !ok || len(groups) != 1 || groups[0] != "admin" {
+			t.Errorf("Groups claim does not match the expected value")
+		}
+		if _, ok := claims["exp"].(float64); !ok {
+			t.Errorf("Expiry claim expected")
+		}
+	})
+	t.Run("Fail GetTokens with wrong password", func(t *testing.T) {
+		_, _, err := f.GetTokens(aws.String("admin"), aws.String("wrong"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "NotAuthorizedException" {
+			t.Errorf("Expected NotAuthorizedException")
+		}
+	})
+	t.Run("Fail GetTokens with unknown user", func(t *testing.T) {
+		_, _, err := f.GetTokens(aws.String("nobody"), aws.String("password1"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "NotAuthorizedException" {
+			t.Errorf("Expected NotAuthorizedException")
+		}
+	})
+	t.Run("Missing parameters on GetTokens", func(t *testing.T) {
+		_, _, err := f.GetTokens(nil, nil)
+		if err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when nil parameters")
+		}
+	})
+}
+
+func TestFakeCognitoRefreshAccessToken(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+	tokens, _, err := f.GetTokens(aws.String("admin"), aws.String("password1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Successfull RefreshAccessToken", func(t *testing.T) {
+		refreshed, err := f.RefreshAccessToken(tokens.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if refreshed.AccessToken == nil || *refreshed.RefreshToken != *tokens.RefreshToken {
+			t.Errorf("Tokens do not match the expected value")
+		}
+	})
+	t.Run("Fail RefreshAccessToken with unknown token", func(t *testing.T) {
+		_, err := f.RefreshAccessToken(aws.String("unknown"))
+		if err == nil {
+			t.Errorf("Error expected")
+		}
+	})
+}
+
+func TestFakeCognitoSignOut(t *testing.T) {
+	handler, _, err := NewFakeCognitoHandler("us-west-2", "us-west-2_test", "client", []FakeUser{
+		{Username: "admin", Password: "password1", Groups: []string{"admin"}},
+		{Username: "bob", Password: "password2"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := handler.(*fakeCognito)
+	login := func(username, password string) *entities.Tokens {
+		tokens, _, err := f.GetTokens(aws.String(username), aws.String(password))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens
+	}
+
+	t.Run("Successfull RevokeToken", func(t *testing.T) {
+		tokens, other := login("bob", "password2"), login("bob", "password2")
+		if err := f.RevokeToken(tokens.RefreshToken); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.RefreshAccessToken(tokens.RefreshToken); err == nil {
+			t.Errorf("Revoked refresh token expected to fail")
+		}
+		if _, err := f.GetMFASettings(tokens.AccessToken); err == nil {
+			t.Errorf("Access token of the revoked session expected to fail")
+		}
+		if _, err := f.GetMFASettings(other.AccessToken); err != nil {
+			t.Errorf("Other sessions expected to be valid: %v", err)
+		}
+		if err := f.RevokeToken(tokens.RefreshToken); err != nil {
+			t.Errorf("Revoking again expected to succeed: %v", err)
+		}
+	})
+	t.Run("Successfull GlobalSignOut", func(t *testing.T) {
+		tokens, other := login("bob", "password2"), login("bob", "password2")
+		if err := f.GlobalSignOut(tokens.AccessToken); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.RefreshAccessToken(other.RefreshToken); err == nil {
+			t.Errorf("Every refresh token expected to be revoked")
+		}
+		if err := f.GlobalSignOut(other.AccessToken); err == nil {
+			t.Errorf("Every access token expected to be revoked")
+		}
+	})
+	t.Run("Successfull AdminGlobalSignOut", func(t *testing.T) {
+		tokens, admin := login("bob", "password2"), login("admin", "password1")
+		if err := f.AdminGlobalSignOut(aws.String("bob")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.RefreshAccessToken(tokens.RefreshToken); err == nil {
+			t.Errorf("Refresh token expected to be revoked")
+		}
+		if _, err := f.RefreshAccessToken(admin.RefreshToken); err != nil {
+			t.Errorf("Other users expected to stay signed in: %v", err)
+		}
+		if err := f.AdminGlobalSignOut(aws.String("unknown")); err == nil {
+			t.Errorf("Unknown user expected to fail")
+		}
+	})
+}
+
+func TestFakeCognitoUsers(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+
+	t.Run("Successfull RegisterUser", func(t *testing.T) {
+		registration, err := f.RegisterUser(&entities.RegistrationRequest{
+			Username: aws.String("bob"),
+			Password: aws.String("password2"),
+			Email:    aws.String("bob@example.com"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if registration.Sub == nil || *registration.Sub == "" || *registration.UserConfirmed {
+			t.Errorf("Unconfirmed user expected")
+		}
+		delivery := registration.CodeDeliveryDetails
+		if delivery == nil || *delivery.DeliveryMedium != "EMAIL" || *delivery.Destination != "b***@e***" {
+			t.Errorf("Code delivery details do not match the expected value")
+		}
+		_, _, err = f.GetTokens(aws.String("bob"), aws.String("password2"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "UserNotConfirmedException" {
+			t.Errorf("Expected UserNotConfirmedException")
+		}
+	})
+	t.Run("Successfull ConfirmSignUp after resend", func(t *testing.T) {
+		code := f.users["bob"].confirmCode
+		delivery, err := f.ResendConfirmationCode(aws.String("bob"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivery == nil || *delivery.AttributeName != "email" {
+			t.Errorf("Code delivery details expected")
+		}
+		if f.users["bob"].confirmCode != code {
+			if err := f.ConfirmSignUp(aws.String("bob"), aws.String(code)); err == nil {
+				t.Errorf("Previous code must not be accepted")
+			}
+		}
+		if err := f.ConfirmSignUp(aws.String("bob"), aws.String(f.users["bob"].confirmCode)); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := f.GetTokens(aws.String("bob"), aws.String("password2")); err != nil {
+			t.Errorf(err.Error())
+		}
+	})
+	t.Run("Fail ConfirmSignUp when already confirmed", func(t *testing.T) {
+		err := f.ConfirmSignUp(aws.String("bob"), aws.String("123456"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "NotAuthorizedException" {
+			t.Errorf("Expected NotAuthorizedException")
+		}
+		_, err = f.ResendConfirmationCode(aws.String("bob"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "InvalidParameterException" {
+			t.Errorf("Expected InvalidParameterException")
+		}
+	})
+	t.Run("Fail RegisterUser with existing username", func(t *testing.T) {
+		_, err := f.RegisterUser(&entities.RegistrationRequest{Username: aws.String("admin"), Password: aws.String("password2")})
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "UsernameExistsException" {
+			t.Errorf("Expected UsernameExistsException")
+		}
+	})
+	t.Run("Fail RegisterUser with short password", func(t *testing.T) {
+		_, err := f.RegisterUser(&entities.RegistrationRequest{Username: aws.String("carol"), Password: aws.String("short")})
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "InvalidPasswordException" {
+			t.Errorf("Expected InvalidPasswordException")
+		}
+	})
+	t.Run("Successfull ListUsers", func(t *testing.T) {
+		page, err := f.ListUsers(nil)
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if len(page.Users) != 2 || *page.Users[0].Username != "admin" || *page.Users[1].Username != "bob" || page.NextCursor != nil {
+			t.Errorf("Two sorted users expected")
+		}
+	})
+	t.Run("Successfull ListUsers pages", func(t *testing.T) {
+		page, err := f.ListUsers(&entities.ListUsersRequest{Limit: aws.Int64(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Users) != 1 || *page.Users[0].Username != "admin" || page.NextCursor == nil {
+			t.Fatalf("First page expected")
+		}
+		page, err = f.ListUsers(&entities.ListUsersRequest{Limit: aws.Int64(1), Cursor: page.NextCursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Users) != 1 || *page.Users[0].Username != "bob" || page.NextCursor != nil {
+			t.Errorf("Last page expected")
+		}
+	})
+	t.Run("Successfull ListUsers with filter", func(t *testing.T) {
+		page, err := f.ListUsers(&entities.ListUsersRequest{
+			Filter:     aws.String(`email ^= "bob@"`),
+			Attributes: []string{"email", "sub"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Users) != 1 || *page.Users[0].Username != "bob" || *page.Users[0].Email != "bob@example.com" || page.Users[0].EmailVerified != nil {
+			t.Errorf("Bob expected with the requested attributes")
+		}
+		page, _ = f.ListUsers(&entities.ListUsersRequest{Filter: aws.String(`username = "bob"`)})
+		if len(page.Users) != 1 || page.Users[0].Sub == nil || page.Users[0].EmailVerified == nil || !*page.Users[0].EmailVerified {
+			t.Errorf("Bob expected with a verified email")
+		}
+		page, _ = f.ListUsers(&entities.ListUsersRequest{Filter: aws.String(`email ^= "x"`)})
+		if len(page.Users) != 0 {
+			t.Errorf("No users expected")
+		}
+	})
+}
+
+func TestFakeCognitoCreateUser(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+
+	t.Run("Successfull CreateUser and first login", func(t *testing.T) {
+		user, err := f.CreateUser(&entities.CreateUserRequest{
+			Username:          aws.String("carol"),
+			TemporaryPassword: aws.String("temporary"),
+			MessageAction:     aws.String("SUPPRESS"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *user.Status != "FORCE_CHANGE_PASSWORD" {
+			t.Errorf("FORCE_CHANGE_PASSWORD status expected")
+		}
+		tokens, challenge, err := f.GetTokens(aws.String("carol"), aws.String("temporary"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens != nil || challenge == nil || *challenge.Name != "NEW_PASSWORD_REQUIRED" {
+			t.Fatalf("NEW_PASSWORD_REQUIRED challenge expected")
+		}
+		answer := &entities.ChallengeRequest{
+			ChallengeName: challenge.Name,
+			Session:       challenge.Session,
+			Username:      aws.String("carol"),
+			NewPassword:   aws.String("new password"),
+		}
+		tokens, _, err = f.RespondToChallenge(answer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens == nil {
+			t.Errorf("Tokens expected after setting the password")
+		}
+		if _, _, err := f.GetTokens(aws.String("carol"), aws.String("new password")); err != nil {
+			t.Errorf("Login with the new password expected")
+		}
+	})
+	t.Run("Fail CreateUser with existing username", func(t *testing.T) {
+		_, err := f.CreateUser(&entities.CreateUserRequest{Username: aws.String("admin")})
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "UsernameExistsException" {
+			t.Errorf("Expected UsernameExistsException")
+		}
+	})
+	t.Run("Fail RESEND to confirmed user", func(t *testing.T) {
+		_, err := f.CreateUser(&entities.CreateUserRequest{Username: aws.String("carol"), MessageAction: aws.String("RESEND")})
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "UnsupportedUserStateException" {
+			t.Errorf("Expected UnsupportedUserStateException")
+		}
+	})
+}
+
+func TestFakeCognitoAdminUser(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+	if _, err := f.CreateUser(&entities.CreateUserRequest{
+		Username:      aws.String("carol"),
+		Email:         aws.String("carol@example.com"),
+		MessageAction: aws.String("SUPPRESS"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Successfull UpdateUserAttributes and DeleteUserAttributes", func(t *testing.T) {
+		err := f.UpdateUserAttributes(aws.String("carol"), map[string]string{"email_verified": "true", "custom:team": "blue"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, _ := f.GetUser(aws.String("carol"))
+		if !*user.EmailVerified || user.CustomAttributes["team"] != "blue" {
+			t.Errorf("Updated attributes expected")
+		}
+		f.UpdateUserAttributes(aws.String("carol"), map[string]string{"email": "new@example.com"})
+		f.DeleteUserAttributes(aws.String("carol"), []string{"custom:team"})
+		user, _ = f.GetUser(aws.String("carol"))
+		if *user.Email != "new@example.com" || user.EmailVerified != nil || user.CustomAttributes != nil {
+			t.Errorf("A new unverified email without custom attributes expected")
+		}
+		if err := f.UpdateUserAttributes(aws.String("carol"), map[string]string{"sub": "x"}); err == nil {
+			t.Errorf("sub is immutable")
+		}
+	})
+	t.Run("Successfull DisableUser and EnableUser", func(t *testing.T) {
+		if err := f.DisableUser(aws.String("admin")); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := f.GetTokens(aws.String("admin"), aws.String("password1")); err == nil {
+			t.Errorf("A disabled user cannot login")
+		}
+		f.EnableUser(aws.String("admin"))
+		if _, _, err := f.GetTokens(aws.String("admin"), aws.String("password1")); err != nil {
+			t.Errorf(err.Error())
+		}
+	})
+	t.Run("Successfull DeleteUser", func(t *testing.T) {
+		if err := f.DeleteUser(aws.String("carol")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.GetUser(aws.String("carol")); err == nil || err.(awserr.Error).Code() != "UserNotFoundException" {
+			t.Errorf("UserNotFoundException expected")
+		}
+	})
+}
+
+func TestFakeCognitoGroups(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+
+	t.Run("Groups of the configured users exist", func(t *testing.T) {
+		page, err := f.ListGroups(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Groups) != 1 || *page.Groups[0].Name != "admin" {
+			t.Errorf("admin group expected")
+		}
+	})
+	t.Run("Successfull CreateGroup and AddUserToGroup", func(t *testing.T) {
+		if _, err := f.CreateGroup(&entities.CreateGroupRequest{Name: aws.String("reader")}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.CreateGroup(&entities.CreateGroupRequest{Name: aws.String("reader")}); err == nil || err.(awserr.Error).Code() != "GroupExistsException" {
+			t.Errorf("GroupExistsException expected")
+		}
+		if err := f.AddUserToGroup(aws.String("admin"), aws.String("reader")); err != nil {
+			t.Fatal(err)
+		}
+		page, _ := f.ListGroupsForUser(aws.String("admin"), &entities.PageRequest{Limit: aws.Int64(1)})
+		if len(page.Groups) != 1 || *page.Groups[0].Name != "admin" || page.NextCursor == nil {
+			t.Errorf("First page expected")
+		}
+		page, _ = f.ListGroupsForUser(aws.String("admin"), &entities.PageRequest{Cursor: page.NextCursor})
+		if len(page.Groups) != 1 || *page.Groups[0].Name != "reader" || page.NextCursor != nil {
+			t.Errorf("Last page expected")
+		}
+		users, _ := f.ListUsers(&entities.ListUsersRequest{IncludeGroups: true})
+		if groups := users.Users[0].Groups; len(groups) != 2 || groups[1] != "reader" {
+			t.Errorf("Groups of the user expected: %v", groups)
+		}
+		if err := f.AddUserToGroup(aws.String("admin"), aws.String("writer")); err == nil || err.(awserr.Error).Code() != "ResourceNotFoundException" {
+			t.Errorf("ResourceNotFoundException expected")
+		}
+	})
+	t.Run("Successfull ListUsersInGroup and DeleteGroup", func(t *testing.T) {
+		page, err := f.ListUsersInGroup(aws.String("reader"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Users) != 1 || *page.Users[0].Username != "admin" {
+			t.Errorf("admin expected in reader")
+		}
+		if err := f.DeleteGroup(aws.String("reader")); err != nil {
+			t.Fatal(err)
+		}
+		groups, _ := f.UserGroups(aws.String("admin"))
+		if len(groups) != 1 || groups[0] != "admin" {
+			t.Errorf("A deleted group has no members: %v", groups)
+		}
+	})
+}
+
+func TestFakeCognitoClientCredentials(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+
+	t.Run("Successfull GetClientCredentialsTokens with all scopes", func(t *testing.T) {
+		tokens, err := f.GetClientCredentialsTokens(aws.String("machine"), aws.String("secret"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *tokens.Scope != "users/read users/write" || tokens.RefreshToken != nil {
+			t.Errorf("Tokens do not match the expected value")
+		}
+		token, _, _ := new(jwt.Parser).ParseUnverified(*tokens.AccessToken, jwt.MapClaims{})
+		claims := token.Claims.(jwt.MapClaims)
+		if _, ok := claims["username"]; ok || claims["client_id"] != "machine" {
+			t.Errorf("Claims do not match the expected value")
+		}
+	})
+	t.Run("Successfull GetClientCredentialsTokens with requested scope", func(t *testing.T) {
+		tokens, err := f.GetClientCredentialsTokens(aws.String("machine"), aws.String("secret"), aws.String("users/read"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *tokens.Scope != "users/read" {
+			t.Errorf("Scope does not match the expected value")
+		}
+	})
+	t.Run("Fail GetClientCredentialsTokens with unknown scope", func(t *testing.T) {
+		_, err := f.GetClientCredentialsTokens(aws.String("machine"), aws.String("secret"), aws.String("admin"))
+		if oerr, ok := err.(*entities.OAuthError); !ok || oerr.Code != "invalid_scope" {
+			t.Errorf("Expected invalid_scope error")
+		}
+	})
+	t.Run("Fail GetClientCredentialsTokens with wrong secret", func(t *testing.T) {
+		_, err := f.GetClientCredentialsTokens(aws.String("machine"), aws.String("wrong"), nil)
+		if oerr, ok := err.(*entities.OAuthError); !ok || oerr.Code != "invalid_client" {
+			t.Errorf("Expected invalid_client error")
+		}
+	})
+	t.Run("AuthenticateClient", func(t *testing.T) {
+		if err := f.AuthenticateClient(aws.String("machine"), aws.String("secret")); err != nil {
+			t.Errorf(err.Error())
+		}
+		if err := f.AuthenticateClient(aws.String("unknown"), aws.String("secret")); err == nil {
+			t.Errorf("Expected invalid_client error")
+		}
+	})
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 seed "12345678901234567890"
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for at, expected := range vectors {
+		code, err := totpCode(secret, time.Unix(at, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("Code at %v is %v, expected %v", at, code, expected)
+		}
+	}
+	if validTOTPCode(secret, "287082", time.Unix(59+2*totpPeriod, 0)) {
+		t.Errorf("Code outside of the allowed drift accepted")
+	}
+}
+
+func TestFakeCognitoSoftwareTokenMFA(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+	tokens, _, err := f.GetTokens(aws.String("admin"), aws.String("password1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken := tokens.AccessToken
+
+	t.Run("Fail enabling MFA before enrollment", func(t *testing.T) {
+		err := f.SetSoftwareTokenMFAPreference(accessToken, true, true)
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "InvalidParameterException" {
+			t.Errorf("Expected InvalidParameterException")
+		}
+	})
+	t.Run("Fail with client credentials token", func(t *testing.T) {
+		clientTokens, err := f.GetClientCredentialsTokens(aws.String("machine"), aws.String("secret"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.AssociateSoftwareToken(clientTokens.AccessToken)
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "NotAuthorizedException" {
+			t.Errorf("Expected NotAuthorizedException")
+		}
+	})
+
+	secretCode, err := f.AssociateSoftwareToken(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Fail VerifySoftwareToken with wrong code", func(t *testing.T) {
+		err := f.VerifySoftwareToken(accessToken, aws.String("000000x"), nil)
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "EnableSoftwareTokenMFAException" {
+			t.Errorf("Expected EnableSoftwareTokenMFAException")
+		}
+	})
+	t.Run("Successfull enrollment and MFA login", func(t *testing.T) {
+		code, _ := totpCode(*secretCode, time.Now())
+		if err := f.VerifySoftwareToken(accessToken, aws.String(code), aws.String("phone")); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.SetSoftwareTokenMFAPreference(accessToken, true, true); err != nil {
+			t.Fatal(err)
+		}
+		settings, err := f.GetMFASettings(accessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(settings.Enabled) != 1 || settings.Preferred == nil || *settings.Preferred != "SOFTWARE_TOKEN_MFA" {
+			t.Errorf("MFA settings do not match the expected value")
+		}
+
+		tokens, challenge, err := f.GetTokens(aws.String("admin"), aws.String("password1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens != nil || challenge == nil || *challenge.Name != "SOFTWARE_TOKEN_MFA" {
+			t.Fatalf("SOFTWARE_TOKEN_MFA challenge expected")
+		}
+		answer := &entities.ChallengeRequest{
+			ChallengeName: challenge.Name,
+			Session:       challenge.Session,
+			Username:      aws.String("admin"),
+			Code:          aws.String("000000x"),
+		}
+		if _, _, err := f.RespondToChallenge(answer); err == nil {
+			t.Errorf("Error expected with wrong code")
+		}
+		answer.Code = aws.String(code)
+		tokens, _, err = f.RespondToChallenge(answer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens == nil || tokens.AccessToken == nil {
+			t.Errorf("Tokens expected after answering the challenge")
+		}
+		if _, _, err := f.RespondToChallenge(answer); err == nil {
+			t.Errorf("Session must not be reused")
+		}
+	})
+	t.Run("Successfull disable", func(t *testing.T) {
+		if err := f.SetSoftwareTokenMFAPreference(accessToken, false, false); err != nil {
+			t.Fatal(err)
+		}
+		_, challenge, err := f.GetTokens(aws.String("admin"), aws.String("password1"))
+		if err != nil || challenge != nil {
+			t.Errorf("No challenge expected once MFA is disabled")
+		}
+	})
+}
+
+func TestFakeCognitoChangePassword(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+	tokens, _, err := f.GetTokens(aws.String("admin"), aws.String("password1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Fail ChangePassword with wrong current password", func(t *testing.T) {
+		err := f.ChangePassword(tokens.AccessToken, aws.String("wrong"), aws.String("new password"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "NotAuthorizedException" {
+			t.Errorf("Expected NotAuthorizedException")
+		}
+	})
+	t.Run("Fail ChangePassword with weak password", func(t *testing.T) {
+		err := f.ChangePassword(tokens.AccessToken, aws.String("password1"), aws.String("short"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "InvalidPasswordException" {
+			t.Errorf("Expected InvalidPasswordException")
+		}
+	})
+	t.Run("Successfull ChangePassword", func(t *testing.T) {
+		if err := f.ChangePassword(tokens.AccessToken, aws.String("password1"), aws.String("new password")); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := f.GetTokens(aws.String("admin"), aws.String("new password")); err != nil {
+			t.Errorf("Login with the new password expected")
+		}
+	})
+}
+
+func TestFakeCognitoForgotPassword(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+
+	t.Run("Fail ForgotPassword with unknown user", func(t *testing.T) {
+		err := f.ForgotPassword(aws.String("nobody"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "UserNotFoundException" {
+			t.Errorf("Expected UserNotFoundException")
+		}
+	})
+	t.Run("Successfull password reset", func(t *testing.T) {
+		if err := f.ForgotPassword(aws.String("admin")); err != nil {
+			t.Fatal(err)
+		}
+		code := f.users["admin"].resetCode
+		err := f.ConfirmForgotPassword(aws.String("admin"), aws.String("wrong"), aws.String("new password"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "CodeMismatchException" {
+			t.Errorf("Expected CodeMismatchException")
+		}
+		err = f.ConfirmForgotPassword(aws.String("admin"), aws.String(code), aws.String("short"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "InvalidPasswordException" {
+			t.Errorf("Expected InvalidPasswordException")
+		}
+		if err := f.ConfirmForgotPassword(aws.String("admin"), aws.String(code), aws.String("new password")); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := f.GetTokens(aws.String("admin"), aws.String("new password")); err != nil {
+			t.Errorf("Login with the new password expected")
+		}
+		if err := f.ConfirmForgotPassword(aws.String("admin"), aws.String(code), aws.String("new password")); err == nil {
+			t.Errorf("Code must not be reused")
+		}
+	})
+	t.Run("Fail ConfirmForgotPassword with expired code", func(t *testing.T) {
+		if err := f.ForgotPassword(aws.String("admin")); err != nil {
+			t.Fatal(err)
+		}
+		f.users["admin"].resetExpires = time.Now().Add(-time.Second)
+		err := f.ConfirmForgotPassword(aws.String("admin"), aws.String(f.users["admin"].resetCode), aws.String("new password"))
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "ExpiredCodeException" {
+			t.Errorf("Expected ExpiredCodeException")
+		}
+	})
+}
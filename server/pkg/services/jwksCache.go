@@ -0,0 +1,191 @@
+package services
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrorUnknownKey = errors.New("Unknown signing key")
+)
+
+type jwksCache struct {
+	source             entities.KeySource
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	expires     time.Time
+	lastAttempt time.Time
+	lastErr     error
+
+	fetchMu sync.Mutex
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewJWKSCache loads the JSON Web Key Set from source and keeps it fresh in the background.
+// The set is refreshed every refreshInterval (or sooner when the source says it expires),
+// and refetched when a token is signed with an unknown kid, but never more often than minRefreshInterval.
+// If a refresh fails the last good key set keeps being served.
+func NewJWKSCache(source entities.KeySource, refreshInterval, minRefreshInterval time.Duration) entities.KeyProvider {
+	c := &jwksCache{
+		source:             source,
+		refreshInterval:    refreshInterval,
+		minRefreshInterval: minRefreshInterval,
+		keys:               map[string]*rsa.PublicKey{},
+		stop:               make(chan struct{}),
+	}
+	c.fetchMu.Lock()
+	if err := c.fetch(); err != nil {
+		log.Errorf("Fail to load JWKS: %v\n", err.Error())
+	}
+	c.fetchMu.Unlock()
+	go c.run()
+	return c
+}
+
+func (c *jwksCache) GetKey(kid string) (*rsa.PublicKey, error) {
+	if key, ok := c.lookup(kid); ok {
+		return key, nil
+	}
+
+	// The user pool may have rotated its keys
+	c.fetchMu.Lock()
+	c.mu.RLock()
+	limited := time.Since(c.lastAttempt) < c.minRefreshInterval
+	c.mu.RUnlock()
+	if !limited {
+		log.Infof("Unknown kid [%v], refreshing JWKS\n", kid)
+		if err := c.fetch(); err != nil {
+			log.Errorf("Fail to refresh JWKS: %v\n", err.Error())
+		}
+	}
+	c.fetchMu.Unlock()
+
+	if key, ok := c.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrorUnknownKey
+}
+
+func (c *jwksCache) Close() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+}
+
+func (c *jwksCache) lookup(kid string) (*rsa.PublicKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+func (c *jwksCache) run() {
+	for {
+		timer := time.NewTimer(c.nextRefresh())
+		select {
+		case <-c.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			c.fetchMu.Lock()
+			if err := c.fetch(); err != nil {
+				log.Errorf("Fail to refresh JWKS, keeping last known keys: %v\n", err.Error())
+			}
+			c.fetchMu.Unlock()
+		}
+	}
+}
+
+func (c *jwksCache) nextRefresh() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.lastErr != nil {
+		return c.minRefreshInterval
+	}
+	wait := c.refreshInterval
+	if !c.expires.IsZero() {
+		if untilExpired := time.Until(c.expires); untilExpired < wait {
+			wait = untilExpired
+		}
+	}
+	if wait < c.minRefreshInterval {
+		wait = c.minRefreshInterval
+	}
+	return wait
+}
+
+// fetch must be called holding fetchMu
+func (c *jwksCache) fetch() (err error) {
+	defer func() {
+		c.mu.Lock()
+		c.lastAttempt = time.Now()
+		c.lastErr = err
+		c.mu.Unlock()
+	}()
+
+	jwks, expires, err := c.source.FetchKeys()
+	if err != nil {
+		return
+	}
+	keys, err := parseKeySet(jwks)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.expires = expires
+	c.mu.Unlock()
+	log.Infof("Loaded %v keys from JWKS\n", len(keys))
+	return nil
+}
+
+func parseKeySet(jwks *entities.JSONWebKeySet) (map[string]*rsa.PublicKey, error) {
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		key, err := publicKey(jwk.E, jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key [%v]: %v", jwk.Kid, err.Error())
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS does not contain any RSA key")
+	}
+	return keys, nil
+}
+
+func publicKey(rawE, rawN string) (*rsa.PublicKey, error) {
+	decodedE, err := base64.RawURLEncoding.DecodeString(rawE)
+	if err != nil {
+		return nil, err
+	}
+	decodedN, err := base64.RawURLEncoding.DecodeString(rawN)
+	if err != nil {
+		return nil, err
+	}
+	e := new(big.Int).SetBytes(decodedE)
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent too large")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(decodedN),
+		E: int(e.Int64()),
+	}, nil
+}
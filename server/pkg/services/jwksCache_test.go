@@ -0,0 +1,162 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+func testJSONWebKey(t *testing.T, kid string) entities.JSONWebKey {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entities.JSONWebKey{
+		Alg: "RS256",
+		Kid: kid,
+		Kty: "RSA",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// jwksServer serves whatever key set is currently stored in it and counts the requests
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     []entities.JSONWebKey
+	status   int
+	header   http.Header
+	requests int
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	for k, v := range s.header {
+		w.Header()[k] = v
+	}
+	if s.status != 0 && s.status != http.StatusOK {
+		w.WriteHeader(s.status)
+		return
+	}
+	json.NewEncoder(w).Encode(entities.JSONWebKeySet{Keys: s.keys})
+}
+
+func (s *jwksServer) set(status int, keys ...entities.JSONWebKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.keys = keys
+}
+
+func (s *jwksServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestJWKSCache(t *testing.T) {
+	key1 := testJSONWebKey(t, "kid1")
+	key2 := testJSONWebKey(t, "kid2")
+
+	t.Run("Successfull GetKey", func(t *testing.T) {
+		s := &jwksServer{keys: []entities.JSONWebKey{key1}}
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+
+		cache := NewJWKSCache(NewRemoteKeySource(ts.URL), time.Hour, time.Hour)
+		defer cache.Close()
+
+		key, err := cache.GetKey("kid1")
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if key == nil || base64.RawURLEncoding.EncodeToString(key.N.Bytes()) != key1.N {
+			t.Errorf("Key does not match the expected value")
+		}
+		if s.count() != 1 {
+			t.Errorf("One request expected")
+		}
+	})
+	t.Run("Refetch on unknown kid after key rotation", func(t *testing.T) {
+		s := &jwksServer{keys: []entities.JSONWebKey{key1}}
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+
+		cache := NewJWKSCache(NewRemoteKeySource(ts.URL), time.Hour, 0)
+		defer cache.Close()
+
+		s.set(http.StatusOK, key2)
+		_, err := cache.GetKey("kid2")
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if s.count() != 2 {
+			t.Errorf("Two requests expected")
+		}
+	})
+	t.Run("Unknown kid refetch is rate limited", func(t *testing.T) {
+		s := &jwksServer{keys: []entities.JSONWebKey{key1}}
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+
+		cache := NewJWKSCache(NewRemoteKeySource(ts.URL), time.Hour, time.Hour)
+		defer cache.Close()
+
+		for i := 0; i < 10; i++ {
+			_, err := cache.GetKey("attacker")
+			if err != ErrorUnknownKey {
+				t.Errorf("Expected unknown key error")
+			}
+		}
+		if s.count() != 1 {
+			t.Errorf("Only the initial request expected")
+		}
+	})
+	t.Run("Keep serving last good keys when refresh fails", func(t *testing.T) {
+		s := &jwksServer{keys: []entities.JSONWebKey{key1}}
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+
+		cache := NewJWKSCache(NewRemoteKeySource(ts.URL), time.Hour, 0)
+		defer cache.Close()
+
+		s.set(http.StatusInternalServerError)
+		_, err := cache.GetKey("kid2")
+		if err != ErrorUnknownKey {
+			t.Errorf("Expected unknown key error")
+		}
+		_, err = cache.GetKey("kid1")
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+	})
+	t.Run("Background refresh honors max-age", func(t *testing.T) {
+		s := &jwksServer{
+			keys:   []entities.JSONWebKey{key1},
+			header: http.Header{"Cache-Control": []string{"public, max-age=0"}},
+		}
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+
+		cache := NewJWKSCache(NewRemoteKeySource(ts.URL), time.Hour, 10*time.Millisecond)
+		defer cache.Close()
+
+		s.set(http.StatusOK, key2)
+		time.Sleep(100 * time.Millisecond)
+		if s.count() < 2 {
+			t.Errorf("Expected the key set to be refreshed")
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+// NewKeySource picks the key source for location:
+// an http(s) URL is downloaded, a file:// URL or plain path is read from disk.
+func NewKeySource(location string) (entities.KeySource, error) {
+	switch {
+	case location == "":
+		return nil, ErrorInvalidInputParameters
+	case strings.HasPrefix(location, "https://"), strings.HasPrefix(location, "http://"):
+		return NewRemoteKeySource(location), nil
+	case strings.HasPrefix(location, "file://"):
+		return NewFileKeySource(strings.TrimPrefix(location, "file://")), nil
+	case strings.Contains(location, "://"):
+		return nil, fmt.Errorf("Unsupported JWKS location: %v", location)
+	default:
+		return NewFileKeySource(location), nil
+	}
+}
+
+type remoteKeySource struct {
+	url    string
+	client *http.Client
+
+	mu   sync.Mutex
+	etag string
+	last *entities.JSONWebKeySet
+}
+
+func NewRemoteKeySource(url string) entities.KeySource {
+	return &remoteKeySource{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (r *remoteKeySource) FetchKeys() (jwks *entities.JSONWebKeySet, expires time.Time, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return
+	}
+	if r.etag != "" && r.last != nil {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return r.last, cacheExpiry(resp.Header, time.Now()), nil
+	case http.StatusOK:
+	default:
+		err = fmt.Errorf("Unexpected status downloading JWKS: %v", resp.Status)
+		return
+	}
+
+	jwks = &entities.JSONWebKeySet{}
+	if err = json.NewDecoder(resp.Body).Decode(jwks); err != nil {
+		return nil, time.Time{}, err
+	}
+	r.etag = resp.Header.Get("ETag")
+	r.last = jwks
+	return jwks, cacheExpiry(resp.Header, time.Now()), nil
+}
+
+type fileKeySource struct {
+	path string
+}
+
+// NewFileKeySource reads the key set from a local JWKS file.
+// The file is read again on every refresh so keys can be rotated by replacing it.
+func NewFileKeySource(path string) entities.KeySource {
+	return &fileKeySource{
+		path: path,
+	}
+}
+
+func (f *fileKeySource) FetchKeys() (jwks *entities.JSONWebKeySet, expires time.Time, err error) {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return
+	}
+	jwks = &entities.JSONWebKeySet{}
+	if err = json.Unmarshal(data, jwks); err != nil {
+		return nil, time.Time{}, err
+	}
+	return
+}
+
+type staticKeySource struct {
+	jwks *entities.JSONWebKeySet
+}
+
+func NewStaticKeySource(jwks *entities.JSONWebKeySet) entities.KeySource {
+	return &staticKeySource{
+		jwks: jwks,
+	}
+}
+
+func (s *staticKeySource) FetchKeys() (jwks *entities.JSONWebKeySet, expires time.Time, err error) {
+	if s.jwks == nil {
+		err = ErrorInvalidInputParameters
+		return
+	}
+	return s.jwks, time.Time{}, nil
+}
+
+// cacheExpiry returns when the response stops being fresh according to its
+// Cache-Control or Expires headers. A zero time means the headers say nothing.
+func cacheExpiry(header http.Header, now time.Time) time.Time {
+	if cacheControl := header.Get("Cache-Control"); cacheControl != "" {
+		for _, directive := range strings.Split(cacheControl, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if directive == "no-cache" || directive == "no-store" {
+				return now
+			}
+			if strings.HasPrefix(directive, "max-age=") {
+				maxAge, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+				if err != nil {
+					continue
+				}
+				if age, err := strconv.Atoi(header.Get("Age")); err == nil {
+					maxAge -= age
+				}
+				return now.Add(time.Duration(maxAge) * time.Second)
+			}
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			return t
+		}
+		return now
+	}
+	return time.Time{}
+}
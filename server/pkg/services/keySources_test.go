@@ -0,0 +1,147 @@
+package services
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+func TestNewKeySource(t *testing.T) {
+	t.Run("Remote", func(t *testing.T) {
+		source, err := NewKeySource("https://cognito-idp.us-west-2.amazonaws.com/pool/.well-known/jwks.json")
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if _, ok := source.(*remoteKeySource); !ok {
+			t.Errorf("Remote key source expected")
+		}
+	})
+	t.Run("File", func(t *testing.T) {
+		for _, location := range []string{"file:///etc/jwks.json", "jwks.json"} {
+			source, err := NewKeySource(location)
+			if err != nil {
+				t.Errorf(err.Error())
+			}
+			if _, ok := source.(*fileKeySource); !ok {
+				t.Errorf("File key source expected for %v", location)
+			}
+		}
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		if _, err := NewKeySource("ftp://jwks.json"); err == nil {
+			t.Errorf("Error expected")
+		}
+		if _, err := NewKeySource(""); err != ErrorInvalidInputParameters {
+			t.Errorf("Expected error when empty location")
+		}
+	})
+}
+
+func TestRemoteKeySource(t *testing.T) {
+	key := testJSONWebKey(t, "kid1")
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		json.NewEncoder(w).Encode(entities.JSONWebKeySet{Keys: []entities.JSONWebKey{key}})
+	}))
+	defer ts.Close()
+
+	source := NewRemoteKeySource(ts.URL)
+	for i := 0; i < 2; i++ {
+		jwks, expires, err := source.FetchKeys()
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if jwks == nil || len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "kid1" {
+			t.Errorf("Key set does not match the expected value")
+		}
+		if expires.Before(time.Now()) {
+			t.Errorf("Expiry in the future expected")
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Two requests expected")
+	}
+}
+
+func TestFileKeySource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+
+	t.Run("Successfull FetchKeys", func(t *testing.T) {
+		data, _ := json.Marshal(entities.JSONWebKeySet{Keys: []entities.JSONWebKey{testJSONWebKey(t, "kid1")}})
+		ioutil.WriteFile(path, data, 0600)
+
+		cache := NewJWKSCache(NewFileKeySource(path), time.Hour, time.Hour)
+		defer cache.Close()
+		if _, err := cache.GetKey("kid1"); err != nil {
+			t.Errorf(err.Error())
+		}
+	})
+	t.Run("Fail FetchKeys with missing file", func(t *testing.T) {
+		_, _, err := NewFileKeySource(filepath.Join(dir, "missing.json")).FetchKeys()
+		if err == nil {
+			t.Errorf("Error expected")
+		}
+	})
+}
+
+func TestStaticKeySource(t *testing.T) {
+	jwks := &entities.JSONWebKeySet{Keys: []entities.JSONWebKey{testJSONWebKey(t, "kid1")}}
+	cache := NewJWKSCache(NewStaticKeySource(jwks), time.Hour, time.Hour)
+	defer cache.Close()
+	if _, err := cache.GetKey("kid1"); err != nil {
+		t.Errorf(err.Error())
+	}
+	if _, err := cache.GetKey("kid2"); err != ErrorUnknownKey {
+		t.Errorf("Expected unknown key error")
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Run("max-age minus Age", func(t *testing.T) {
+		expiry := cacheExpiry(http.Header{
+			"Cache-Control": []string{"public, max-age=3600"},
+			"Age":           []string{"600"},
+		}, now)
+		if !expiry.Equal(now.Add(50 * time.Minute)) {
+			t.Errorf("Expiry does not match the expected value")
+		}
+	})
+	t.Run("no-cache", func(t *testing.T) {
+		expiry := cacheExpiry(http.Header{"Cache-Control": []string{"no-cache"}}, now)
+		if !expiry.Equal(now) {
+			t.Errorf("Expiry does not match the expected value")
+		}
+	})
+	t.Run("Expires", func(t *testing.T) {
+		expiry := cacheExpiry(http.Header{"Expires": []string{"Wed, 01 Jan 2020 01:00:00 GMT"}}, now)
+		if !expiry.Equal(now.Add(time.Hour)) {
+			t.Errorf("Expiry does not match the expected value")
+		}
+	})
+	t.Run("No headers", func(t *testing.T) {
+		expiry := cacheExpiry(http.Header{}, now)
+		if !expiry.IsZero() {
+			t.Errorf("Zero expiry expected")
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+// oauth2Client talks to the OAuth 2.0 token endpoint of the user pool domain
+type oauth2Client struct {
+	tokenURL   string
+	httpClient *http.Client
+}
+
+func newOAuth2Client(tokenURL string) *oauth2Client {
+	return &oauth2Client{
+		tokenURL:   tokenURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type tokenResponse struct {
+	AccessToken      *string `json:"access_token"`
+	IDToken          *string `json:"id_token"`
+	RefreshToken     *string `json:"refresh_token"`
+	TokenType        *string `json:"token_type"`
+	ExpiresIn        *int64  `json:"expires_in"`
+	Scope            *string `json:"scope"`
+	Error            string  `json:"error"`
+	ErrorDescription string  `json:"error_description"`
+}
+
+// requestTokens posts params to the token endpoint. Confidential clients authenticate with
+// HTTP Basic, public clients (empty clientSecret) only send their client_id.
+func (o *oauth2Client) requestTokens(params url.Values, clientID, clientSecret string) (*entities.Tokens, error) {
+	if clientSecret == "" {
+		params.Set("client_id", clientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, o.tokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	log.Infof("Requesting %v tokens\n", params.Get("grant_type"))
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body := &tokenResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(body); err != nil {
+		return nil, fmt.Errorf("Invalid token endpoint response (%v): %v", resp.Status, err.Error())
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		if body.Error == "" {
+			body.Error = "server_error"
+		}
+		return nil, &entities.OAuthError{Code: body.Error, Description: body.ErrorDescription}
+	}
+	if body.AccessToken == nil {
+		return nil, &entities.OAuthError{Code: "server_error", Description: "token endpoint did not return an access token"}
+	}
+
+	tokens := &entities.Tokens{
+		AccessToken:  body.AccessToken,
+		IDToken:      body.IDToken,
+		RefreshToken: body.RefreshToken,
+		TokenType:    body.TokenType,
+		ExpiresIn:    body.ExpiresIn,
+		Scope:        body.Scope,
+	}
+	if tokens.TokenType == nil {
+		tokens.TokenType = aws.String("Bearer")
+	}
+	if tokens.Scope == nil {
+		tokens.Scope = scopeFromAccessToken(*tokens.AccessToken)
+	}
+	return tokens, nil
+}
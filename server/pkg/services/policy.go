@@ -0,0 +1,222 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// AnyRole in a permission lets through every authenticated caller
+	AnyRole = "*"
+	// AnyMethod in a permission matches every HTTP method
+	AnyMethod = "*"
+)
+
+type policyEvaluator struct {
+	path string
+
+	mu      sync.RWMutex
+	policy  *entities.Policy
+	modTime time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewPolicyEvaluator loads the YAML (or JSON, by extension) policy file at path.
+// When reloadInterval is positive the file is checked for changes in the background and
+// reloaded; a policy that fails to load or validate is ignored and the previous one kept.
+func NewPolicyEvaluator(path string, reloadInterval time.Duration) (entities.PolicyEvaluator, error) {
+	p := &policyEvaluator{
+		path: path,
+		stop: make(chan struct{}),
+	}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	if reloadInterval > 0 {
+		go p.watch(reloadInterval)
+	}
+	return p, nil
+}
+
+func (p *policyEvaluator) Evaluate(principal *entities.Principal, method, path string) (allowed bool, reason string) {
+	p.mu.RLock()
+	policy := p.policy
+	p.mu.RUnlock()
+
+	roles := principalRoles(policy, principal)
+	required := []string{}
+	for _, permission := range policy.Permissions {
+		if !matchMethod(permission.Methods, method) || !matchAnyRoute(permission.Routes, path) {
+			continue
+		}
+		for _, role := range permission.Roles {
+			if role == AnyRole || roles[role] {
+				return true, ""
+			}
+			required = append(required, role)
+		}
+	}
+	if len(required) == 0 {
+		return false, fmt.Sprintf("no permission allows %v %v", method, path)
+	}
+	return false, fmt.Sprintf("%v %v requires one of the roles: %v", method, path, strings.Join(required, ", "))
+}
+
+func (p *policyEvaluator) Reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	policy, err := loadPolicy(p.path)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.policy = policy
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+	log.Infof("Loaded policy [%v] with %v roles and %v permissions\n", p.path, len(policy.Roles), len(policy.Permissions))
+	return nil
+}
+
+func (p *policyEvaluator) Close() {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+}
+
+func (p *policyEvaluator) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(p.path)
+			if err != nil {
+				log.Errorf("Fail to stat policy [%v]: %v\n", p.path, err.Error())
+				continue
+			}
+			p.mu.RLock()
+			changed := !info.ModTime().Equal(p.modTime)
+			p.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := p.Reload(); err != nil {
+				log.Errorf("Fail to reload policy, keeping the previous one: %v\n", err.Error())
+			}
+		}
+	}
+}
+
+func loadPolicy(path string) (*entities.Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &entities.Policy{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, policy)
+	default:
+		err = yaml.UnmarshalStrict(data, policy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid policy [%v]: %v", path, err.Error())
+	}
+	if err = validatePolicy(policy); err != nil {
+		return nil, fmt.Errorf("Invalid policy [%v]: %v", path, err.Error())
+	}
+	return policy, nil
+}
+
+func validatePolicy(policy *entities.Policy) error {
+	for i, permission := range policy.Permissions {
+		if len(permission.Roles) == 0 || len(permission.Methods) == 0 || len(permission.Routes) == 0 {
+			return fmt.Errorf("permission %v needs roles, methods and routes", i)
+		}
+		for _, role := range permission.Roles {
+			if _, ok := policy.Roles[role]; !ok && role != AnyRole {
+				return fmt.Errorf("permission %v uses undefined role %v", i, role)
+			}
+		}
+		for _, route := range permission.Routes {
+			if !strings.HasPrefix(route, "/") {
+				return fmt.Errorf("permission %v route %v must start with /", i, route)
+			}
+		}
+	}
+	return nil
+}
+
+func principalRoles(policy *entities.Policy, principal *entities.Principal) map[string]bool {
+	roles := map[string]bool{}
+	if principal == nil {
+		return roles
+	}
+	for name, role := range policy.Roles {
+		for _, group := range role.Groups {
+			if principal.InGroup(group) {
+				roles[name] = true
+			}
+		}
+		for _, scope := range role.Scopes {
+			if principal.HasScope(scope) {
+				roles[name] = true
+			}
+		}
+	}
+	return roles
+}
+
+func matchMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == AnyMethod || strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyRoute(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if matchRoute(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRoute(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range patternSegments {
+		if segment == "**" && i == len(patternSegments)-1 {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if segment == "*" || strings.HasPrefix(segment, ":") {
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
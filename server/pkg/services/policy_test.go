@@ -0,0 +1,135 @@
+package services
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+const testPolicy = `
+roles:
+  admin:
+    groups: [admin]
+  reader:
+    scopes: [users.read]
+permissions:
+  - roles: [admin]
+    methods: ["*"]
+    routes: [/api/admin/**]
+  - roles: [admin, reader]
+    methods: [GET]
+    routes: [/api/user/list, /api/user/:username]
+  - roles: ["*"]
+    methods: [GET]
+    routes: [/api/user/me]
+`
+
+func writePolicy(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPolicyEvaluator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policy, err := NewPolicyEvaluator(writePolicy(t, dir, "policy.yaml", testPolicy), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer policy.Close()
+
+	admin := &entities.Principal{Groups: []string{"admin"}}
+	reader := &entities.Principal{Scopes: []string{"users.read"}}
+	nobody := &entities.Principal{}
+
+	tests := []struct {
+		name      string
+		principal *entities.Principal
+		method    string
+		path      string
+		allowed   bool
+	}{
+		{"Admin any method under admin", admin, "DELETE", "/api/admin/users/bob", true},
+		{"Admin root of admin", admin, "GET", "/api/admin", true},
+		{"Reader denied admin", reader, "GET", "/api/admin/users", false},
+		{"Reader lists users", reader, "GET", "/api/user/list", true},
+		{"Reader gets one user", reader, "GET", "/api/user/bob", true},
+		{"Reader cannot post", reader, "POST", "/api/user/list", false},
+		{"Nobody denied list", nobody, "GET", "/api/user/list", false},
+		{"Anyone authenticated", nobody, "GET", "/api/user/me", true},
+		{"No permission", admin, "GET", "/api/other", false},
+		{"Segment count must match", reader, "GET", "/api/user/bob/groups", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed, reason := policy.Evaluate(test.principal, test.method, test.path)
+			if allowed != test.allowed {
+				t.Errorf("Expected allowed %v: %v", test.allowed, reason)
+			}
+			if !allowed && reason == "" {
+				t.Errorf("Expected a reason for the denial")
+			}
+		})
+	}
+}
+
+func TestPolicyReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writePolicy(t, dir, "policy.json", `{
+		"roles": {"admin": {"groups": ["admin"]}},
+		"permissions": [{"roles": ["admin"], "methods": ["GET"], "routes": ["/api/user/list"]}]
+	}`)
+	admin := &entities.Principal{Groups: []string{"admin"}}
+
+	policy, err := NewPolicyEvaluator(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer policy.Close()
+	if allowed, _ := policy.Evaluate(admin, "GET", "/api/user/list"); !allowed {
+		t.Errorf("Expected allowed")
+	}
+
+	t.Run("Invalid policy keeps the previous one", func(t *testing.T) {
+		writePolicy(t, dir, "policy.json", `{"permissions": [{"roles": ["ghost"], "methods": ["GET"], "routes": ["/api"]}]}`)
+		if err := policy.Reload(); err == nil {
+			t.Errorf("Error expected")
+		}
+		if allowed, _ := policy.Evaluate(admin, "GET", "/api/user/list"); !allowed {
+			t.Errorf("Expected allowed")
+		}
+	})
+	t.Run("Changed file is reloaded in the background", func(t *testing.T) {
+		writePolicy(t, dir, "policy.json", `{
+			"roles": {"admin": {"groups": ["admin"]}},
+			"permissions": [{"roles": ["admin"], "methods": ["GET"], "routes": ["/api/other"]}]
+		}`)
+		future := time.Now().Add(time.Hour)
+		os.Chtimes(path, future, future)
+		time.Sleep(100 * time.Millisecond)
+		if allowed, _ := policy.Evaluate(admin, "GET", "/api/user/list"); allowed {
+			t.Errorf("Expected the new policy to deny")
+		}
+	})
+}
+
+func TestNewPolicyEvaluatorFails(t *testing.T) {
+	if _, err := NewPolicyEvaluator("missing.yaml", 0); err == nil {
+		t.Errorf("Error expected")
+	}
+}
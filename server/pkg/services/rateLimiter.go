@@ -0,0 +1,64 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+type rateWindow struct {
+	attempts int
+	resets   time.Time
+}
+
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+// NewRateLimiter allows limit attempts per key in every fixed window, in memory
+func NewRateLimiter(limit int, window time.Duration) entities.RateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		windows: map[string]*rateWindow{},
+	}
+}
+
+func (r *rateLimiter) Allow(key string) (bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.sweep(now)
+	w, ok := r.windows[key]
+	if !ok || !now.Before(w.resets) {
+		w = &rateWindow{resets: now.Add(r.window)}
+		r.windows[key] = w
+	}
+	if w.attempts >= r.limit {
+		return false, w.resets.Sub(now)
+	}
+	w.attempts++
+	return true, 0
+}
+
+// sweep drops the expired windows so keys from past attempts do not pile up
+func (r *rateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.window {
+		return
+	}
+	for key, w := range r.windows {
+		if !now.Before(w.resets) {
+			delete(r.windows, key)
+		}
+	}
+	r.lastSweep = now
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := NewRateLimiter(2, time.Minute).(*rateLimiter)
+	limiter.now = func() time.Time { return now }
+
+	t.Run("Allow up to the limit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if ok, _ := limiter.Allow("bob"); !ok {
+				t.Errorf("Attempt %v expected to be allowed", i)
+			}
+		}
+		ok, retryAfter := limiter.Allow("bob")
+		if ok || retryAfter != time.Minute {
+			t.Errorf("Attempt over the limit expected to be denied for a minute")
+		}
+	})
+	t.Run("Keys are independent", func(t *testing.T) {
+		if ok, _ := limiter.Allow("alice"); !ok {
+			t.Errorf("Other key expected to be allowed")
+		}
+	})
+	t.Run("Allow again in the next window", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		if ok, _ := limiter.Allow("bob"); !ok {
+			t.Errorf("Attempt expected to be allowed in the next window")
+		}
+		if len(limiter.windows) != 1 {
+			t.Errorf("Expired windows expected to be dropped")
+		}
+	})
+}
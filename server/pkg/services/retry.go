@@ -0,0 +1,27 @@
+package services
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	// throttleMaxAttempts and throttleBackoff retry the requests throttled by Cognito, the backoff doubles on each attempt
+	throttleMaxAttempts = 5
+	throttleBackoff     = 500 * time.Millisecond
+)
+
+// retryThrottled calls Cognito again while it throttles the requests
+func retryThrottled(sleep func(time.Duration), call func() error) (err error) {
+	backoff := throttleBackoff
+	for attempt := 1; ; attempt++ {
+		err = call()
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != "TooManyRequestsException" || attempt == throttleMaxAttempts {
+			return
+		}
+		sleep(backoff)
+		backoff *= 2
+	}
+}
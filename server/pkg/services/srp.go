@@ -0,0 +1,164 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// srpN is the 3072-bit group of RFC 5054 (RFC 3526 group 15) Cognito uses with the generator 2
+const srpN = "" +
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+	"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+	"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+	"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+	"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+	"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+	"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+	"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+	"15728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64" +
+	"ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+	"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6B" +
+	"F12FFA06D98A0864D87602733EC86A64521F2B18177B200C" +
+	"BBE117577A615D6C770988C0BAD946E208E24FA074E5AB31" +
+	"43DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF"
+
+const (
+	srpG = "2"
+	// srpTimestampLayout is the TIMESTAMP Cognito signs, the day of the month is not padded
+	srpTimestampLayout = "Mon Jan 2 15:04:05 MST 2006"
+	srpDerivedKeyInfo  = "Caldera Derived Key"
+)
+
+var (
+	srpGroupN, _ = new(big.Int).SetString(srpN, 16)
+	srpGroupG, _ = new(big.Int).SetString(srpG, 16)
+	// srpK is the SRP-6a multiplier k = H(N | g)
+	srpK = hexHashInt(padHex(srpGroupN) + padHex(srpGroupG))
+
+	ErrorInvalidSRPParameters = errors.New("Invalid SRP parameters")
+)
+
+// srpClient is one USER_SRP_AUTH login: it sends SRP_A and answers the PASSWORD_VERIFIER challenge
+type srpClient struct {
+	userPoolName string
+	a            *big.Int
+	bigA         *big.Int
+}
+
+// newSRPClient starts a login against the user pool, e.g. us-west-2_abcdef
+func newSRPClient(userPoolID string) (*srpClient, error) {
+	random := make([]byte, 128)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return newSRPClientWithSecret(userPoolID, new(big.Int).SetBytes(random))
+}
+
+// newSRPClientWithSecret uses a given private value, only meant for test vectors
+func newSRPClientWithSecret(userPoolID string, a *big.Int) (*srpClient, error) {
+	a = new(big.Int).Mod(a, srpGroupN)
+	bigA := new(big.Int).Exp(srpGroupG, a, srpGroupN)
+	if bigA.Sign() == 0 {
+		return nil, ErrorInvalidSRPParameters
+	}
+	return &srpClient{
+		userPoolName: userPoolID[strings.Index(userPoolID, "_")+1:],
+		a:            a,
+		bigA:         bigA,
+	}, nil
+}
+
+// SRPA is the public value sent as SRP_A
+func (s *srpClient) SRPA() string {
+	return s.bigA.Text(16)
+}
+
+// passwordClaim computes the PASSWORD_CLAIM_SIGNATURE from the PASSWORD_VERIFIER challenge parameters,
+// userID is USER_ID_FOR_SRP and timestamp the TIMESTAMP sent along with the signature
+func (s *srpClient) passwordClaim(userID, password, saltHex, srpBHex, secretBlock, timestamp string) (string, error) {
+	bigB, ok := new(big.Int).SetString(srpBHex, 16)
+	if !ok || new(big.Int).Mod(bigB, srpGroupN).Sign() == 0 {
+		return "", ErrorInvalidSRPParameters
+	}
+	salt, ok := new(big.Int).SetString(saltHex, 16)
+	if !ok {
+		return "", ErrorInvalidSRPParameters
+	}
+	secret, err := base64.StdEncoding.DecodeString(secretBlock)
+	if err != nil {
+		return "", ErrorInvalidSRPParameters
+	}
+
+	u := hexHashInt(padHex(s.bigA) + padHex(bigB))
+	if u.Sign() == 0 {
+		return "", ErrorInvalidSRPParameters
+	}
+	// x = H(salt | H(poolName | userID | ":" | password))
+	identity := sha256.Sum256([]byte(s.userPoolName + userID + ":" + password))
+	x := hexHashInt(padHex(salt) + hex.EncodeToString(identity[:]))
+
+	// S = (B - k * g^x) ^ (a + u * x) mod N
+	gx := new(big.Int).Exp(srpGroupG, x, srpGroupN)
+	base := new(big.Int).Sub(bigB, new(big.Int).Mul(srpK, gx))
+	base.Mod(base, srpGroupN)
+	exponent := new(big.Int).Add(s.a, new(big.Int).Mul(u, x))
+	bigS := new(big.Int).Exp(base, exponent, srpGroupN)
+
+	key := derivedKey(mustDecodeHex(padHex(bigS)), mustDecodeHex(padHex(u)))
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s.userPoolName))
+	mac.Write([]byte(userID))
+	mac.Write(secret)
+	mac.Write([]byte(timestamp))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// srpTimestamp formats the time the way Cognito expects in TIMESTAMP
+func srpTimestamp(now time.Time) string {
+	return now.UTC().Format(srpTimestampLayout)
+}
+
+// derivedKey is the 16 byte HKDF-SHA256 key of the premaster secret, salted with u
+func derivedKey(ikm, salt []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(srpDerivedKeyInfo))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:16]
+}
+
+// padHex encodes the value in hex as a positive two's complement number, like the Cognito SDKs
+func padHex(value *big.Int) string {
+	h := value.Text(16)
+	if len(h)%2 == 1 {
+		return "0" + h
+	}
+	if strings.ContainsAny(h[:1], "89abcdef") {
+		return "00" + h
+	}
+	return h
+}
+
+func hexHashInt(hexValue string) *big.Int {
+	sum := sha256.Sum256(mustDecodeHex(hexValue))
+	return new(big.Int).SetBytes(sum[:])
+}
+
+func mustDecodeHex(hexValue string) []byte {
+	b, err := hex.DecodeString(hexValue)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
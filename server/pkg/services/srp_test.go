@@ -0,0 +1,144 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSRPServer plays the Cognito side of USER_SRP_AUTH for a user
+type testSRPServer struct {
+	userPoolName string
+	userID       string
+	salt         *big.Int
+	b            *big.Int
+	verifier     *big.Int
+}
+
+func newTestSRPServer(userPoolID, userID, password, saltHex, bHex string) *testSRPServer {
+	s := &testSRPServer{
+		userPoolName: userPoolID[strings.Index(userPoolID, "_")+1:],
+		userID:       userID,
+	}
+	s.salt, _ = new(big.Int).SetString(saltHex, 16)
+	s.b, _ = new(big.Int).SetString(bHex, 16)
+	identity := sha256.Sum256([]byte(s.userPoolName + userID + ":" + password))
+	x := hexHashInt(padHex(s.salt) + hex.EncodeToString(identity[:]))
+	s.verifier = new(big.Int).Exp(srpGroupG, x, srpGroupN)
+	return s
+}
+
+// SRPB is k * v + g^b
+func (s *testSRPServer) SRPB() string {
+	bigB := new(big.Int).Mul(srpK, s.verifier)
+	bigB.Add(bigB, new(big.Int).Exp(srpGroupG, s.b, srpGroupN))
+	return bigB.Mod(bigB, srpGroupN).Text(16)
+}
+
+// signature is the PASSWORD_CLAIM_SIGNATURE Cognito expects, from S = (A * v^u) ^ b
+func (s *testSRPServer) signature(srpA, secretBlock, timestamp string) string {
+	bigA, _ := new(big.Int).SetString(srpA, 16)
+	bigB, _ := new(big.Int).SetString(s.SRPB(), 16)
+	u := hexHashInt(padHex(bigA) + padHex(bigB))
+	base := new(big.Int).Mul(bigA, new(big.Int).Exp(s.verifier, u, srpGroupN))
+	bigS := new(big.Int).Exp(base.Mod(base, srpGroupN), s.b, srpGroupN)
+
+	secret, _ := base64.StdEncoding.DecodeString(secretBlock)
+	mac := hmac.New(sha256.New, derivedKey(mustDecodeHex(padHex(bigS)), mustDecodeHex(padHex(u))))
+	mac.Write([]byte(s.userPoolName + s.userID))
+	mac.Write(secret)
+	mac.Write([]byte(timestamp))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSRPConstants(t *testing.T) {
+	// k = H(00 | N | 02) as computed by the Cognito SDKs
+	if srpK.Text(16) != "538282c4354742d7cbbde2359fcf67f9f5b3a6b08791e5011b43b8a5b66d9ee6" {
+		t.Errorf("Multiplier k does not match the Cognito value")
+	}
+	if srpGroupN.BitLen() != 3072 || !srpGroupN.ProbablyPrime(10) {
+		t.Errorf("N is not a 3072-bit prime")
+	}
+}
+
+func TestSRPPasswordClaim(t *testing.T) {
+	const (
+		userPoolID  = "us-west-2_AbCdEf123"
+		userID      = "3b0e8a3e-1f7a-4b9e-9c6a-2f1e5d4c3b2a"
+		password    = "Passw0rd!"
+		salt        = "e9d1c5a3b7f2"
+		secretBlock = "c2VjcmV0IGJsb2NrIGZyb20gY29nbml0byAA/w=="
+		timestamp   = "Sun Oct 4 09:05:07 UTC 2026"
+	)
+	server := newTestSRPServer(userPoolID, userID, password, salt, strings.Repeat("b7", 40))
+
+	t.Run("Known vector", func(t *testing.T) {
+		// Generated with the reference Python implementation of the Cognito SRP client
+		a, _ := new(big.Int).SetString(strings.Repeat("a", 64)+strings.Repeat("1234567890abcdef", 8), 16)
+		srp, err := newSRPClientWithSecret(userPoolID, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(srp.SRPA(), "d156864eb82df58dc7c5ffcc785881b9b720a7e0") {
+			t.Errorf("SRP_A does not match the expected value")
+		}
+		signature, err := srp.passwordClaim(userID, password, salt, server.SRPB(), secretBlock, timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signature != "bHXtvc6pV5fiE+mHWt+6VqoWwQB6eiA78xhrBMUi40A=" {
+			t.Errorf("Signature does not match the expected value")
+		}
+	})
+	t.Run("Server accepts the claim", func(t *testing.T) {
+		srp, err := newSRPClient(userPoolID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := srp.passwordClaim(userID, password, salt, server.SRPB(), secretBlock, timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signature != server.signature(srp.SRPA(), secretBlock, timestamp) {
+			t.Errorf("Signature does not match the server one")
+		}
+	})
+	t.Run("Server rejects the wrong password", func(t *testing.T) {
+		srp, _ := newSRPClient(userPoolID)
+		signature, err := srp.passwordClaim(userID, "wrong", salt, server.SRPB(), secretBlock, timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signature == server.signature(srp.SRPA(), secretBlock, timestamp) {
+			t.Errorf("Signature with the wrong password must not match")
+		}
+	})
+	t.Run("Fail with B multiple of N", func(t *testing.T) {
+		srp, _ := newSRPClient(userPoolID)
+		_, err := srp.passwordClaim(userID, password, salt, srpN, secretBlock, timestamp)
+		if err != ErrorInvalidSRPParameters {
+			t.Errorf("Expected invalid SRP parameters")
+		}
+	})
+	t.Run("Fail with invalid parameters", func(t *testing.T) {
+		srp, _ := newSRPClient(userPoolID)
+		if _, err := srp.passwordClaim(userID, password, "not hex", server.SRPB(), secretBlock, timestamp); err != ErrorInvalidSRPParameters {
+			t.Errorf("Expected invalid SRP parameters")
+		}
+		if _, err := srp.passwordClaim(userID, password, salt, server.SRPB(), "%%%", timestamp); err != ErrorInvalidSRPParameters {
+			t.Errorf("Expected invalid SRP parameters")
+		}
+	})
+}
+
+func TestSRPTimestamp(t *testing.T) {
+	at := time.Date(2026, time.October, 4, 9, 5, 7, 0, time.FixedZone("AEST", 10*3600))
+	if ts := srpTimestamp(at); ts != "Sat Oct 3 23:05:07 UTC 2026" {
+		t.Errorf("Timestamp %v does not match the expected value", ts)
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+// denylistSweepInterval is how often the expired entries are dropped
+const denylistSweepInterval = time.Minute
+
+type deniedKey struct {
+	deniedAt  time.Time
+	expiresAt time.Time
+}
+
+type tokenDenylist struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]deniedKey
+	lastSweep time.Time
+}
+
+// NewTokenDenylist keeps the revoked tokens in memory, they are only refused by this instance
+func NewTokenDenylist() entities.TokenDenylist {
+	return &tokenDenylist{
+		now:  time.Now,
+		keys: map[string]deniedKey{},
+	}
+}
+
+func (d *tokenDenylist) Deny(key string, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.sweep(now)
+	// A key denied again keeps the entry until the latest expiry
+	if denied, ok := d.keys[key]; ok && denied.expiresAt.After(expiresAt) {
+		expiresAt = denied.expiresAt
+	}
+	// iat has a second precision, the tokens issued in the second of the denial stay valid,
+	// before it as well as after it
+	d.keys[key] = deniedKey{deniedAt: now.Truncate(time.Second), expiresAt: expiresAt}
+	return nil
+}
+
+// Denied refuses the tokens issued before the second of the denial, so a user signing in again
+// in that second is not refused. A token issued earlier in that second is not refused either.
+func (d *tokenDenylist) Denied(key string, issuedAt time.Time) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	denied, ok := d.keys[key]
+	if !ok || !d.now().Before(denied.expiresAt) {
+		return false, nil
+	}
+	return issuedAt.Before(denied.deniedAt), nil
+}
+
+// sweep drops the entries of the tokens that have expired
+func (d *tokenDenylist) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < denylistSweepInterval {
+		return
+	}
+	for key, denied := range d.keys {
+		if !now.Before(denied.expiresAt) {
+			delete(d.keys, key)
+		}
+	}
+	d.lastSweep = now
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenDenylist(t *testing.T) {
+	now := time.Unix(1000, int64(500*time.Millisecond))
+	issued := time.Unix(999, 0)
+	denylist := NewTokenDenylist().(*tokenDenylist)
+	denylist.now = func() time.Time { return now }
+
+	t.Run("Deny the tokens issued before the denial", func(t *testing.T) {
+		if err := denylist.Deny("user:bob", now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if denied, _ := denylist.Denied("user:bob", issued); !denied {
+			t.Errorf("Token issued before the denial expected to be denied")
+		}
+		if denied, _ := denylist.Denied("user:bob", time.Time{}); !denied {
+			t.Errorf("Token without issue time expected to be denied")
+		}
+		if denied, _ := denylist.Denied("user:alice", issued); denied {
+			t.Errorf("Other key expected to be allowed")
+		}
+	})
+	t.Run("Allow the tokens issued in the second of the denial, before or after it", func(t *testing.T) {
+		// iat has no fraction of second, it cannot tell a login 100ms before the denial from one 100ms after
+		if denied, _ := denylist.Denied("user:bob", time.Unix(1000, int64(400*time.Millisecond)).Truncate(time.Second)); denied {
+			t.Errorf("Token issued in the second of the denial expected to be allowed")
+		}
+		if denied, _ := denylist.Denied("user:bob", time.Unix(1001, 0)); denied {
+			t.Errorf("Token issued after the denial expected to be allowed")
+		}
+	})
+	t.Run("Keep the latest expiry", func(t *testing.T) {
+		if err := denylist.Deny("user:bob", now.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(30 * time.Minute)
+		if denied, _ := denylist.Denied("user:bob", issued); !denied {
+			t.Errorf("Token expected to be denied until the latest expiry")
+		}
+	})
+	t.Run("Drop the expired entries", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		if denied, _ := denylist.Denied("user:bob", issued); denied {
+			t.Errorf("Expired entry expected to be ignored")
+		}
+		if err := denylist.Deny("jti", now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if len(denylist.keys) != 1 {
+			t.Errorf("Expired entries expected to be dropped")
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	importEmail       = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	importPhoneNumber = regexp.MustCompile(`^\+[1-9][0-9]{5,14}$`)
+	// importAttributes are the standard attributes an import can set besides email and phone_number
+	importAttributes = []string{"name", "given_name", "family_name", "middle_name", "nickname", "preferred_username",
+		"locale", "zoneinfo", "birthdate", "gender", "website", "picture", "profile", "address", "email_verified", "phone_number_verified"}
+)
+
+type userImporter struct {
+	admin       entities.UserAdmin
+	concurrency int
+	sleep       func(time.Duration)
+}
+
+// NewUserImporter creates the users of an import with at most concurrency requests to Cognito at a time
+func NewUserImporter(admin entities.UserAdmin, concurrency int) entities.UserImporter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &userImporter{
+		admin:       admin,
+		concurrency: concurrency,
+		sleep:       time.Sleep,
+	}
+}
+
+// ReadUsers reads a CSV file with a header row, or JSON Lines of objects with the same keys.
+// The keys are username, temporary_password, email, phone_number and the attributes, e.g. name or custom:team.
+func (i *userImporter) ReadUsers(reader io.Reader, format string) ([]entities.ImportRow, error) {
+	switch format {
+	case "csv":
+		return readCSVUsers(reader)
+	case "jsonl":
+		return readJSONLinesUsers(reader)
+	}
+	return nil, fmt.Errorf("Unsupported import format [%v], use csv or jsonl", format)
+}
+
+func readCSVUsers(reader io.Reader) ([]entities.ImportRow, error) {
+	records := csv.NewReader(reader)
+	header, err := records.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("The file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+		if !importColumn(header[i]) {
+			return nil, fmt.Errorf("Unknown column [%v]", header[i])
+		}
+	}
+	if !containsString(header, "username") {
+		return nil, fmt.Errorf("The username column is required")
+	}
+
+	rows := []entities.ImportRow{}
+	// Lines are counted from the header, assuming the values have no line breaks
+	for line := 2; ; line++ {
+		record, err := records.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			perr, ok := err.(*csv.ParseError)
+			if !ok {
+				return nil, err
+			}
+			rows = append(rows, entities.ImportRow{Line: perr.Line, Invalid: perr.Err.Error()})
+			continue
+		}
+		fields := map[string]string{}
+		for i, value := range record {
+			fields[header[i]] = value
+		}
+		rows = append(rows, importRow(line, fields))
+	}
+}
+
+func readJSONLinesUsers(reader io.Reader) ([]entities.ImportRow, error) {
+	rows := []entities.ImportRow{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := map[string]string{}
+		if err := json.Unmarshal([]byte(text), &fields); err != nil {
+			rows = append(rows, entities.ImportRow{Line: line, Invalid: "Invalid JSON object of strings: " + err.Error()})
+			continue
+		}
+		for name := range fields {
+			if !importColumn(name) {
+				rows = append(rows, entities.ImportRow{Line: line, Invalid: "Unknown key [" + name + "]"})
+				fields = nil
+				break
+			}
+		}
+		if fields != nil {
+			rows = append(rows, importRow(line, fields))
+		}
+	}
+	return rows, scanner.Err()
+}
+
+func importColumn(name string) bool {
+	switch name {
+	case "username", "temporary_password", "email", "phone_number":
+		return true
+	}
+	return containsString(importAttributes, name) || (strings.HasPrefix(name, entities.CustomAttributePrefix) && len(name) > len(entities.CustomAttributePrefix))
+}
+
+// importRow validates the fields of a row, empty values are left unset
+func importRow(line int, fields map[string]string) entities.ImportRow {
+	row := entities.ImportRow{Line: line, User: &entities.CreateUserRequest{Attributes: map[string]string{}}}
+	for name, value := range fields {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		switch name {
+		case "username":
+			row.User.Username = aws.String(value)
+		case "temporary_password":
+			row.User.TemporaryPassword = aws.String(value)
+		case "email":
+			row.User.Email = aws.String(value)
+		case "phone_number":
+			row.User.PhoneNumber = aws.String(value)
+		default:
+			row.User.Attributes[name] = value
+		}
+	}
+	switch user := row.User; {
+	case user.Username == nil:
+		row.Invalid = "username is required"
+	case strings.ContainsAny(*user.Username, " \t"):
+		row.Invalid = "username cannot contain spaces"
+	case user.Email != nil && !importEmail.MatchString(*user.Email):
+		row.Invalid = "Invalid email: " + *user.Email
+	case user.PhoneNumber != nil && !importPhoneNumber.MatchString(*user.PhoneNumber):
+		row.Invalid = "Invalid phone_number, expected the E.164 format such as +14325551212: " + *user.PhoneNumber
+	}
+	return row
+}
+
+// ImportUsers skips the usernames already in the pool or repeated in the file,
+// the results are in the order of the rows.
+func (i *userImporter) ImportUsers(rows []entities.ImportRow, options entities.ImportOptions) *entities.ImportReport {
+	results := make([]entities.ImportResult, len(rows))
+	pending := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < i.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range pending {
+				results[index] = i.importUser(rows[index], options)
+			}
+		}()
+	}
+	seen := map[string]bool{}
+	for index, row := range rows {
+		switch {
+		case row.Invalid != "":
+			results[index] = entities.ImportResult{Line: row.Line, Status: entities.ImportStatusFailed, Reason: row.Invalid}
+			if row.User != nil {
+				results[index].Username = row.User.Username
+			}
+		case seen[*row.User.Username]:
+			results[index] = entities.ImportResult{Line: row.Line, Username: row.User.Username, Status: entities.ImportStatusSkipped, Reason: "Repeated username"}
+		default:
+			seen[*row.User.Username] = true
+			pending <- index
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	report := &entities.ImportReport{DryRun: options.DryRun, Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case entities.ImportStatusCreated:
+			report.Created++
+		case entities.ImportStatusSkipped:
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+	}
+	log.Infof("Imported users, dry run: %v, created: %v, skipped: %v, failed: %v\n", report.DryRun, report.Created, report.Skipped, report.Failed)
+	return report
+}
+
+func (i *userImporter) importUser(row entities.ImportRow, options entities.ImportOptions) entities.ImportResult {
+	result := entities.ImportResult{Line: row.Line, Username: row.User.Username, Status: entities.ImportStatusCreated}
+	user := *row.User
+	user.MessageAction = options.MessageAction
+
+	var err error
+	if options.DryRun {
+		// The request is validated here as Cognito would, then the username must be free
+		if err = validateCreateUserRequest(&user); err == nil {
+			err = i.retry(func() error {
+				_, err := i.admin.GetUser(user.Username)
+				return err
+			})
+			if err == nil {
+				err = awserr.New("UsernameExistsException", "User already exists", nil)
+			} else if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "UserNotFoundException" {
+				err = nil
+			}
+		}
+	} else {
+		err = i.retry(func() error {
+			_, err := i.admin.CreateUser(&user)
+			return err
+		})
+	}
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "UsernameExistsException" {
+		result.Status = entities.ImportStatusSkipped
+		result.Reason = "User already exists"
+	} else if err != nil {
+		result.Status = entities.ImportStatusFailed
+		result.Reason = err.Error()
+	}
+	return result
+}
+
+// retry calls Cognito again while it throttles the requests
+func (i *userImporter) retry(call func() error) error {
+	return retryThrottled(i.sleep, call)
+}
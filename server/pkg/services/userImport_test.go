@@ -0,0 +1,146 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+// throttledAdmin fails the first calls to CreateUser with TooManyRequestsException
+type throttledAdmin struct {
+	entities.UserAdmin
+	mu        sync.Mutex
+	throttles int
+	calls     int
+}
+
+func (t *throttledAdmin) CreateUser(request *entities.CreateUserRequest) (*entities.UserModel, error) {
+	t.mu.Lock()
+	t.calls++
+	throttled := t.calls <= t.throttles
+	t.mu.Unlock()
+	if throttled {
+		return nil, awserr.New("TooManyRequestsException", "Too many requests", nil)
+	}
+	return t.UserAdmin.CreateUser(request)
+}
+
+func newTestUserImporter(admin entities.UserAdmin) *userImporter {
+	importer := NewUserImporter(admin, 2).(*userImporter)
+	importer.sleep = func(time.Duration) {}
+	return importer
+}
+
+func TestReadUsers(t *testing.T) {
+	importer := newTestUserImporter(nil)
+
+	t.Run("Successfull ReadUsers from CSV", func(t *testing.T) {
+		rows, err := importer.ReadUsers(strings.NewReader("username,email,custom:team\n"+
+			"carol,carol@example.com,blue\n"+
+			"dave,not an email,\n"+
+			"erin,erin@example.com\n"), "csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 {
+			t.Fatalf("3 rows expected")
+		}
+		if rows[0].Invalid != "" || *rows[0].User.Email != "carol@example.com" || rows[0].User.Attributes["custom:team"] != "blue" {
+			t.Errorf("Valid row expected: %+v", rows[0])
+		}
+		if rows[1].Line != 3 || !strings.HasPrefix(rows[1].Invalid, "Invalid email") {
+			t.Errorf("Invalid email expected: %+v", rows[1])
+		}
+		if rows[2].Line != 4 || rows[2].Invalid == "" {
+			t.Errorf("Missing field expected: %+v", rows[2])
+		}
+	})
+	t.Run("Successfull ReadUsers from JSON Lines", func(t *testing.T) {
+		rows, err := importer.ReadUsers(strings.NewReader(`{"username":"carol","phone_number":"+14325551212"}`+"\n\n"+
+			`{"username":"dave","team":"blue"}`+"\n"+
+			`{"username":1}`), "jsonl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 || rows[0].Invalid != "" || *rows[0].User.PhoneNumber != "+14325551212" {
+			t.Fatalf("Valid row expected: %+v", rows)
+		}
+		if rows[1].Line != 3 || rows[1].Invalid != "Unknown key [team]" || rows[2].Invalid == "" {
+			t.Errorf("Invalid rows expected: %+v", rows[1:])
+		}
+	})
+	t.Run("Fail ReadUsers", func(t *testing.T) {
+		files := []struct{ content, format string }{
+			{"username,team\ncarol,blue\n", "csv"},
+			{"email\ncarol@example.com\n", "csv"},
+			{"", "csv"},
+			{"username\ncarol\n", "xlsx"},
+		}
+		for _, file := range files {
+			if _, err := importer.ReadUsers(strings.NewReader(file.content), file.format); err == nil {
+				t.Errorf("Error expected for %q", file.content)
+			}
+		}
+	})
+}
+
+func TestImportUsers(t *testing.T) {
+	f, _ := newTestFakeCognito(t)
+	rows := []entities.ImportRow{
+		{Line: 2, User: &entities.CreateUserRequest{Username: aws.String("carol"), Attributes: map[string]string{"name": "Carol"}}},
+		{Line: 3, User: &entities.CreateUserRequest{Username: aws.String("admin")}},
+		{Line: 4, User: &entities.CreateUserRequest{Username: aws.String("carol")}},
+		{Line: 5, User: &entities.CreateUserRequest{Username: aws.String("dave")}, Invalid: "Invalid email"},
+	}
+	expected := []string{entities.ImportStatusCreated, entities.ImportStatusSkipped, entities.ImportStatusSkipped, entities.ImportStatusFailed}
+	options := entities.ImportOptions{MessageAction: aws.String("SUPPRESS")}
+
+	t.Run("Successfull dry run", func(t *testing.T) {
+		report := newTestUserImporter(f).ImportUsers(rows, entities.ImportOptions{DryRun: true})
+		for i, result := range report.Results {
+			if result.Status != expected[i] || result.Line != rows[i].Line {
+				t.Errorf("Line %v: %v expected, got %+v", rows[i].Line, expected[i], result)
+			}
+		}
+		if !report.DryRun || report.Created != 1 || report.Skipped != 2 || report.Failed != 1 {
+			t.Errorf("Report does not match the expected value: %+v", report)
+		}
+		if _, err := f.GetUser(aws.String("carol")); err == nil {
+			t.Errorf("A dry run creates no user")
+		}
+	})
+	t.Run("Successfull ImportUsers with retries", func(t *testing.T) {
+		admin := &throttledAdmin{UserAdmin: f, throttles: 2}
+		report := newTestUserImporter(admin).ImportUsers(rows, options)
+		for i, result := range report.Results {
+			if result.Status != expected[i] {
+				t.Errorf("Line %v: %v expected, got %+v", rows[i].Line, expected[i], result)
+			}
+		}
+		user, err := f.GetUser(aws.String("carol"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *user.Name != "Carol" || admin.calls != 4 {
+			t.Errorf("carol expected after the retries, calls: %v", admin.calls)
+		}
+	})
+	t.Run("Fail ImportUsers when throttled", func(t *testing.T) {
+		admin := &throttledAdmin{UserAdmin: f, throttles: throttleMaxAttempts}
+		report := newTestUserImporter(admin).ImportUsers(rows[3:], options)
+		if report.Failed != 1 {
+			t.Errorf("Invalid row expected to fail")
+		}
+		report = newTestUserImporter(admin).ImportUsers([]entities.ImportRow{
+			{Line: 2, User: &entities.CreateUserRequest{Username: aws.String("erin")}},
+		}, options)
+		if report.Failed != 1 || report.Results[0].Reason != "TooManyRequestsException: Too many requests" || admin.calls != throttleMaxAttempts {
+			t.Errorf("Failure expected after %v attempts: %+v", throttleMaxAttempts, report.Results[0])
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/paujim/cognitoserver/server/pkg/entities"
+)
+
+// maxPageLimit is the largest page the Cognito list APIs return
+const maxPageLimit = 60
+
+var (
+	ErrorInvalidCursor = errors.New("Invalid cursor")
+
+	userFilterExpression = regexp.MustCompile(`^\s*([\w:]+)\s*(\^?=)\s*"((?:[^"\\]|\\.)*)"\s*$`)
+	// userFilterAttributes are the attributes Cognito ListUsers can filter on
+	userFilterAttributes = []string{"username", "email", "phone_number", "name", "given_name", "family_name",
+		"preferred_username", "cognito:user_status", "status", "sub"}
+	// userFilterAliases rename the fields of the user model that Cognito names differently.
+	// In Cognito status is Enabled or Disabled, here it is the status of the user model.
+	userFilterAliases = map[string]string{"status": "cognito:user_status"}
+)
+
+// userFilter is a Cognito filter expression: attribute = "value" (exact) or attribute ^= "value" (prefix)
+type userFilter struct {
+	attribute string
+	prefix    bool
+	value     string
+}
+
+func parseUserFilter(expression string) (*userFilter, error) {
+	match := userFilterExpression.FindStringSubmatch(expression)
+	if match == nil {
+		return nil, fmt.Errorf("Invalid filter, expected attribute = \"value\" or attribute ^= \"value\": %v", expression)
+	}
+	if !containsString(userFilterAttributes, match[1]) {
+		return nil, fmt.Errorf("Unable to filter on %v, use one of: %v", match[1], strings.Join(userFilterAttributes, ", "))
+	}
+	attribute := match[1]
+	if alias, ok := userFilterAliases[attribute]; ok {
+		attribute = alias
+	}
+	return &userFilter{
+		attribute: attribute,
+		prefix:    match[2] == "^=",
+		value:     strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(match[3]),
+	}, nil
+}
+
+// String is the filter expression sent to Cognito
+func (f *userFilter) String() string {
+	operator := "="
+	if f.prefix {
+		operator = "^="
+	}
+	value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(f.value)
+	return fmt.Sprintf(`%v %v "%v"`, f.attribute, operator, value)
+}
+
+func (f *userFilter) matches(value string) bool {
+	if f.prefix {
+		return strings.HasPrefix(value, f.value)
+	}
+	return value == f.value
+}
+
+// pageLimit defaults to, and caps at, the largest Cognito page
+func pageLimit(limit *int64) (int64, error) {
+	if limit == nil {
+		return maxPageLimit, nil
+	}
+	if *limit < 1 || *limit > maxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %v", maxPageLimit)
+	}
+	return *limit, nil
+}
+
+// encodeCursor hides the pagination token, clients must only pass it back
+func encodeCursor(token *string) *string {
+	if token == nil || *token == "" {
+		return nil
+	}
+	return aws.String(base64.RawURLEncoding.EncodeToString([]byte(*token)))
+}
+
+func decodeCursor(cursor *string) (*string, error) {
+	if cursor == nil || *cursor == "" {
+		return nil, nil
+	}
+	token, err := base64.RawURLEncoding.DecodeString(*cursor)
+	if err != nil || len(token) == 0 {
+		return nil, ErrorInvalidCursor
+	}
+	return aws.String(string(token)), nil
+}
+
+// userModel maps a Cognito user, with the attributes it was fetched with
+func userModel(user *cognitoidentityprovider.UserType) entities.UserModel {
+	model := entities.UserModel{
+		Username:     user.Username,
+		Status:       user.UserStatus,
+		Enabled:      user.Enabled,
+		Created:      user.UserCreateDate,
+		LastModified: user.UserLastModifiedDate,
+	}
+	for _, attribute := range user.Attributes {
+		model.SetAttribute(aws.StringValue(attribute.Name), aws.StringValue(attribute.Value))
+	}
+	for _, option := range user.MFAOptions {
+		model.MFAOptions = append(model.MFAOptions, entities.MFAOption{
+			DeliveryMedium: option.DeliveryMedium,
+			AttributeName:  option.AttributeName,
+		})
+	}
+	return model
+}
+
+// pageParameters are the limit and pagination token of a page request
+func pageParameters(request *entities.PageRequest) (limit int64, token *string, err error) {
+	if request == nil {
+		request = &entities.PageRequest{}
+	}
+	if limit, err = pageLimit(request.Limit); err != nil {
+		return
+	}
+	token, err = decodeCursor(request.Cursor)
+	return
+}
+
+func groupModel(group *cognitoidentityprovider.GroupType) entities.Group {
+	return entities.Group{
+		Name:         group.GroupName,
+		Description:  group.Description,
+		Precedence:   group.Precedence,
+		Created:      group.CreationDate,
+		LastModified: group.LastModifiedDate,
+	}
+}
+
+func groupPage(groups []*cognitoidentityprovider.GroupType, nextToken *string) *entities.GroupPage {
+	page := &entities.GroupPage{
+		Groups:     []entities.Group{},
+		NextCursor: encodeCursor(nextToken),
+	}
+	for _, group := range groups {
+		page.Groups = append(page.Groups, groupModel(group))
+	}
+	return page
+}